@@ -0,0 +1,81 @@
+package pongo2
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrAccessDenied is wrapped by the error returned when a template accesses
+// a method or struct field which is not permitted by the AccessPolicy of its
+// TemplateSet. Use errors.Is to check for it.
+var ErrAccessDenied = errors.New("access denied by access policy")
+
+// AccessPolicy restricts which methods and struct fields of the Go values
+// passed to a template can be accessed from within the template. It's useful
+// when executing user-provided templates over rich domain objects. The zero
+// value doesn't restrict anything.
+//
+// The policy only applies to the resolution of variables (like `user.Name` or
+// `user["Name"]`); functions provided directly by the context, map keys and
+// the methods of the forloop object are not affected.
+type AccessPolicy struct {
+	// DenyMethods forbids calling any method.
+	DenyMethods bool
+
+	// AllowedMethods, if non-nil, only permits calling the listed methods
+	// of the given types. A type and its pointer type are treated the same:
+	//
+	//	policy.AllowedMethods = map[reflect.Type][]string{
+	//		reflect.TypeOf(User{}): {"FullName", "IsAdmin"},
+	//	}
+	AllowedMethods map[reflect.Type][]string
+
+	// RequireFieldTag only permits accessing struct fields which have
+	// a `pongo2` struct tag, e. g. `pongo2:"name"`. Fields tagged with
+	// `pongo2:"-"` can't be accessed either.
+	RequireFieldTag bool
+}
+
+var typeOfForLoopInformation = reflect.TypeOf(new(tagForLoopInformation))
+
+// checkMethod returns an error if the method name of typ must not be called.
+// The methods of pongo2's forloop object (e. g. forloop.Cycle) are always allowed.
+func (p *AccessPolicy) checkMethod(typ reflect.Type, name string) error {
+	if p == nil || typ == typeOfForLoopInformation {
+		return nil
+	}
+	if p.DenyMethods {
+		return fmt.Errorf("%w: method '%s' of type %s", ErrAccessDenied, name, typ.String())
+	}
+	if p.AllowedMethods == nil {
+		return nil
+	}
+
+	candidates := []reflect.Type{typ}
+	if typ.Kind() == reflect.Ptr {
+		candidates = append(candidates, typ.Elem())
+	} else {
+		candidates = append(candidates, reflect.PtrTo(typ))
+	}
+	for _, candidate := range candidates {
+		for _, allowed := range p.AllowedMethods[candidate] {
+			if allowed == name {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: method '%s' of type %s is not allowed", ErrAccessDenied, name, typ.String())
+}
+
+// checkField returns an error if the struct field must not be accessed.
+func (p *AccessPolicy) checkField(typ reflect.Type, field reflect.StructField) error {
+	if p == nil || !p.RequireFieldTag {
+		return nil
+	}
+	if tag, ok := field.Tag.Lookup("pongo2"); !ok || tag == "-" {
+		return fmt.Errorf("%w: field '%s' of type %s has no pongo2 struct tag", ErrAccessDenied, field.Name, typ.String())
+	}
+	return nil
+}
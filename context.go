@@ -1,14 +1,30 @@
 package pongo2
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 )
 
-var autoescape = true
+const (
+	autoescapeUnset int32 = iota
+	autoescapeOn
+	autoescapeOff
+)
 
+// SetAutoescape enables or disables autoescaping for templates of the DefaultSet
+// which are created afterwards; other sets and existing templates aren't affected.
+// Once called, it takes precedence over DefaultSet.Options.DisableAutoescape.
+// It's safe for concurrent use.
+//
+// Deprecated: Set Options.DisableAutoescape of a TemplateSet (or a Template) instead.
 func SetAutoescape(newValue bool) {
-	autoescape = newValue
+	if newValue {
+		atomic.StoreInt32(&DefaultSet.autoescape, autoescapeOn)
+	} else {
+		atomic.StoreInt32(&DefaultSet.autoescape, autoescapeOff)
+	}
 }
 
 // A Context type provides constants, variables, instances or functions to a template.
@@ -77,8 +93,24 @@ func (c Context) Update(other Context) Context {
 // To create your own execution context within tags, use the
 // NewChildExecutionContext(parent) function.
 type ExecutionContext struct {
-	template   *Template
-	macroDepth int
+	template     *Template
+	macroDepth   int
+	includeDepth int
+	state        *executionState
+	loopControl  *loopControl // nil outside of for-loops
+
+	// inheritance is the inheritance chain of the executed template, from the
+	// root parent to the template which has been executed
+	inheritance []*Template
+
+	// goCtx is the context.Context the template is executed with; done is
+	// its cached Done()-channel (nil if the context can never be cancelled).
+	goCtx context.Context
+	done  <-chan struct{}
+
+	// escaper escapes values if Autoescape is enabled; it's the escaper of
+	// the executed template unless changed by the autoescape tag
+	escaper Escaper
 
 	Autoescape bool
 	Public     Context
@@ -90,7 +122,7 @@ var pongo2MetaContext = Context{
 	"version": Version,
 }
 
-func newExecutionContext(tpl *Template, ctx Context) *ExecutionContext {
+func newExecutionContext(goCtx context.Context, tpl *Template, ctx Context, limits Limits) *ExecutionContext {
 	privateCtx := make(Context)
 
 	// Make the pongo2-related funcs/vars available to the context
@@ -98,16 +130,27 @@ func newExecutionContext(tpl *Template, ctx Context) *ExecutionContext {
 
 	return &ExecutionContext{
 		template: tpl,
+		state:    &executionState{limits: limits},
+		goCtx:    goCtx,
+		done:     goCtx.Done(),
 
+		escaper:    tpl.escaper,
 		Public:     ctx,
 		Private:    privateCtx,
-		Autoescape: autoescape,
+		Autoescape: !tpl.Options.DisableAutoescape,
 	}
 }
 
 func NewChildExecutionContext(parent *ExecutionContext) *ExecutionContext {
 	newctx := &ExecutionContext{
-		template: parent.template,
+		template:     parent.template,
+		includeDepth: parent.includeDepth,
+		state:        parent.state,
+		loopControl:  parent.loopControl,
+		inheritance:  parent.inheritance,
+		goCtx:        parent.goCtx,
+		done:         parent.done,
+		escaper:      parent.escaper,
 
 		Public:     parent.Public,
 		Private:    make(Context),
@@ -121,6 +164,88 @@ func NewChildExecutionContext(parent *ExecutionContext) *ExecutionContext {
 	return newctx
 }
 
+// escapesHTML returns true if values are escaped using the (default) HTML escaper.
+func (ctx *ExecutionContext) escapesHTML() bool {
+	_, isHTML := ctx.escaper.(htmlEscaper)
+	return isHTML || ctx.escaper == nil
+}
+
+// escapesContextually returns true if values are escaped depending on their
+// position within the HTML document (see AutoescapeContextual).
+func (ctx *ExecutionContext) escapesContextually() bool {
+	return ctx.escapesHTML() && ctx.template.Options.AutoescapeMode == AutoescapeContextual
+}
+
+// escape writes s escaped by the current escaper to writer.
+func (ctx *ExecutionContext) escape(writer TemplateWriter, s string) {
+	if ctx.escapesHTML() {
+		escapeReplacer.WriteString(writer, s)
+		return
+	}
+	writer.WriteString(ctx.escaper.Escape(s))
+}
+
+// writeValue writes the output of a value to writer, escaping it if autoescaping
+// is enabled. Values marked as safe (or filtered by safe, see filteredSafe) are
+// written as-is. ec is the HTML context of the value (for AutoescapeContextual).
+func (ctx *ExecutionContext) writeValue(writer TemplateWriter, value *Value, filteredSafe bool, ec escapeContext) {
+	if !filteredSafe && !value.isSafe() && ctx.Autoescape {
+		_, typ := value.htmlContent()
+		if ctx.escapesContextually() {
+			// escape depending on where the value is placed within the HTML document
+			writer.WriteString(ec.escape(value))
+			return
+		}
+		if ctx.escapesHTML() && typ == contentHTML {
+			// pre-sanitized HTML (template.HTML); html/template's other types
+			// (such as template.URL) are only safe in other contexts
+			writer.WriteAny(value)
+			return
+		}
+		if value.IsString() || typ != contentPlain {
+			ctx.escape(writer, value.String())
+			return
+		}
+	}
+
+	writer.WriteAny(value)
+}
+
+// GoContext returns the context.Context the template is being executed with.
+// It is context.Background() unless the template was executed using one of
+// the ExecuteContext functions.
+func (ctx *ExecutionContext) GoContext() context.Context {
+	return ctx.goCtx
+}
+
+// checkAborted returns an error if the execution's context.Context has been
+// cancelled, its deadline has passed or the output limit has been exceeded.
+func (ctx *ExecutionContext) checkAborted(token *Token) *Error {
+	if ctx.state.writeErr != nil {
+		return ctx.OrigError(ctx.state.writeErr, token)
+	}
+	select {
+	case <-ctx.done:
+		return ctx.OrigError(ctx.goCtx.Err(), token)
+	default:
+		return nil
+	}
+}
+
+// nodeState returns the state of node for the current execution; it's
+// created using newState on first use.
+func (ctx *ExecutionContext) nodeState(node INode, newState func() any) any {
+	if ctx.state.nodeStates == nil {
+		ctx.state.nodeStates = make(map[INode]any)
+	}
+	state, has := ctx.state.nodeStates[node]
+	if !has {
+		state = newState()
+		ctx.state.nodeStates[node] = state
+	}
+	return state
+}
+
 func (ctx *ExecutionContext) Error(msg string, token *Token) *Error {
 	return ctx.OrigError(errors.New(msg), token)
 }
@@ -135,8 +260,18 @@ func (ctx *ExecutionContext) OrigError(err error, token *Token) *Error {
 		line = token.Line
 		col = token.Col
 	}
+
+	// The error might have occurred in a block of a child template
+	template := ctx.template
+	for _, t := range ctx.inheritance {
+		if t.name == filename {
+			template = t
+			break
+		}
+	}
+
 	return &Error{
-		Template:  ctx.template,
+		Template:  template,
 		Filename:  filename,
 		Line:      line,
 		Column:    col,
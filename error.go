@@ -3,7 +3,7 @@ package pongo2
 import (
 	"bufio"
 	"fmt"
-	"os"
+	"strings"
 )
 
 // The Error type is being used to address an error during lexing, parsing or
@@ -58,28 +58,26 @@ func (e *Error) Error() string {
 	return s
 }
 
+// Unwrap returns the underlying error (e. g. context.Canceled or
+// context.DeadlineExceeded if the execution has been aborted).
+func (e *Error) Unwrap() error {
+	return e.OrigError
+}
+
 // RawLine returns the affected line from the original template, if available.
+// The line is taken from the already loaded template source if possible;
+// otherwise the template is loaded through the template set's loaders.
 func (e *Error) RawLine() (line string, available bool, outErr error) {
-	if e.Line <= 0 || e.Filename == "<string>" {
+	if e.Line <= 0 || e.Template == nil {
 		return "", false, nil
 	}
 
-	filename := e.Filename
-	if e.Template != nil {
-		filename = e.Template.set.resolveFilename(e.Template, e.Filename)
-	}
-	file, err := os.Open(filename)
+	src, err := e.Template.sourceOf(e.Filename)
 	if err != nil {
 		return "", false, err
 	}
-	defer func() {
-		err := file.Close()
-		if err != nil && outErr == nil {
-			outErr = err
-		}
-	}()
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(strings.NewReader(src))
 	l := 0
 	for scanner.Scan() {
 		l++
@@ -87,5 +85,5 @@ func (e *Error) RawLine() (line string, available bool, outErr error) {
 			return scanner.Text(), true, nil
 		}
 	}
-	return "", false, nil
+	return "", false, scanner.Err()
 }
@@ -1,6 +1,12 @@
 package pongo2
 
-import "strings"
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
 
 var escapeReplacer = strings.NewReplacer(
 	"&", "&amp;",
@@ -9,3 +15,132 @@ var escapeReplacer = strings.NewReplacer(
 	"\"", "&quot;",
 	"'", "&#39;",
 )
+
+// escapeNospaceReplacer escapes values of unquoted attributes which must neither
+// contain whitespace nor characters ending or starting another attribute.
+var escapeNospaceReplacer = strings.NewReplacer(
+	"&", "&amp;",
+	">", "&gt;",
+	"<", "&lt;",
+	"\"", "&quot;",
+	"'", "&#39;",
+	" ", "&#32;",
+	"\t", "&#9;",
+	"\n", "&#10;",
+	"\f", "&#12;",
+	"\r", "&#13;",
+	"=", "&#61;",
+	"`", "&#96;",
+	"\x00", "\uFFFD",
+)
+
+// unsafeURL replaces URLs with a scheme which could execute code (such as javascript:).
+const unsafeURL = "#ZgotmplZ"
+
+// filterURL returns s if it's a relative URL or its scheme is http, https or mailto.
+func filterURL(s string) string {
+	if i := strings.IndexAny(s, ":/?#"); i >= 0 && s[i] == ':' {
+		switch strings.ToLower(s[:i]) {
+		case "http", "https", "mailto":
+		default:
+			return unsafeURL
+		}
+	}
+	return s
+}
+
+// escapeURL percent-encodes s. If norm is true, characters with a special meaning
+// within URLs (such as / or ?) are kept, so only s is normalized.
+func escapeURL(s string, norm bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+			continue
+		case norm && strings.IndexByte("!#$%&*+,/:;=?@[]", c) >= 0:
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// escapeJSString escapes s to be embedded within a JavaScript string literal
+// (which itself may be embedded in an HTML element or attribute).
+func escapeJSString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\'', '"', '`', '<', '>', '&', '=', '+':
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case '/':
+			b.WriteString(`\/`)
+		case '\u2028', '\u2029':
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			if r < ' ' {
+				fmt.Fprintf(&b, `\x%02x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+// escapeJSValue returns value as a JavaScript expression: nil, booleans, numbers
+// and strings are written as literals, everything else as JSON.
+func escapeJSValue(value *Value) string {
+	switch {
+	case value.IsNil():
+		return "null"
+	case value.IsBool():
+		return strconv.FormatBool(value.Bool())
+	case value.IsInteger():
+		return strconv.Itoa(value.Integer())
+	case value.IsFloat():
+		return strconv.FormatFloat(value.Float(), 'g', -1, 64)
+	case value.IsString():
+		return `"` + escapeJSString(value.String()) + `"`
+	}
+
+	// json.Marshal escapes <, > and & so the result can't end a script element
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "null"
+	}
+	// Leading spaces prevent the value from being parsed as part of a preceding
+	// token (such as a division or a comment)
+	return " " + string(b) + " "
+}
+
+// escapeCSS escapes all characters of s which could end a CSS value, string or
+// declaration.
+func escapeCSS(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if r >= ' ' && !strings.ContainsRune(`"&'()+/:;<>\{}`, r) {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteString(`\` + strconv.FormatInt(int64(r), 16))
+		// A following hex digit or space would be part of the escape sequence
+		if i < len(s) && strings.IndexByte("0123456789abcdefABCDEF \t\n\f\r", s[i]) >= 0 {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
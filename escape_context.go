@@ -0,0 +1,384 @@
+package pongo2
+
+import "strings"
+
+// htmlState is the state of the HTML tokenizer at a position within a template.
+type htmlState uint8
+
+const (
+	htmlStateText          htmlState = iota // text content
+	htmlStateTagName                        // <na
+	htmlStateTag                            // <a |
+	htmlStateAttrName                       // <a hr
+	htmlStateAfterAttrName                  // <a href |
+	htmlStateBeforeValue                    // <a href=|
+	htmlStateAttrValue                      // <a href="|
+	htmlStateScript                         // <script>|
+	htmlStateStyle                          // <style>|
+	htmlStateComment                        // <!-- |
+)
+
+// attrType classifies the value of an attribute.
+type attrType uint8
+
+const (
+	attrNormal attrType = iota
+	attrURL             // href, src, ...
+	attrScript          // onclick, onload, ...
+	attrStyle           // style
+)
+
+// urlPart is the position within a URL attribute value.
+type urlPart uint8
+
+const (
+	urlPartNone        urlPart = iota // nothing of the URL has been written yet
+	urlPartPreQuery                   // scheme, host or path
+	urlPartQueryOrFrag                // query string or fragment
+)
+
+// urlAttributes are the attributes whose values are URLs.
+var urlAttributes = map[string]bool{
+	"action":     true,
+	"background": true,
+	"cite":       true,
+	"classid":    true,
+	"codebase":   true,
+	"data":       true,
+	"formaction": true,
+	"href":       true,
+	"icon":       true,
+	"longdesc":   true,
+	"manifest":   true,
+	"poster":     true,
+	"profile":    true,
+	"src":        true,
+	"usemap":     true,
+	"xmlns":      true,
+}
+
+// escapeContext is the HTML context at a position within a template. It's tracked
+// across the HTML tokens of a template at compile time and defines how a variable
+// at this position is escaped if Options.AutoescapeMode is AutoescapeContextual.
+//
+// The tracking follows a template linearly (the branches of an if-tag are treated
+// as if they were written one after another) and doesn't look into included templates.
+// Blocks overriding a block of a static parent start at the context of the parent's block.
+type escapeContext struct {
+	state    htmlState
+	element  string // name of the current element (lower case, e. g. "/div" for end tags)
+	attr     string // name of the current attribute (lower case)
+	attrType attrType
+	delim    byte // quote of the current attribute value, 0 if it's unquoted
+	url      urlPart
+
+	// JavaScript within script elements and event handler attributes
+	jsQuote   byte // quote of the current string literal, 0 outside of literals
+	jsEscape  bool // the previous character within a string literal was a backslash
+	jsComment byte // '/' within a line comment, '*' within a block comment
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// advance returns the context after the HTML text s.
+func (c escapeContext) advance(s string) escapeContext {
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch c.state {
+		case htmlStateText:
+			if ch != '<' {
+				continue
+			}
+			if strings.HasPrefix(s[i+1:], "!--") {
+				c.state = htmlStateComment
+				i += 3
+			} else if i+1 < len(s) && (isASCIILetter(s[i+1]) || s[i+1] == '/') {
+				c.state = htmlStateTagName
+				c.element = ""
+			}
+		case htmlStateTagName:
+			switch {
+			case ch == '>':
+				c.enterElement()
+			case isHTMLSpace(ch), ch == '/' && c.element != "":
+				c.state = htmlStateTag
+			default:
+				c.element += strings.ToLower(string(ch))
+			}
+		case htmlStateTag, htmlStateAfterAttrName:
+			switch {
+			case ch == '>':
+				c.enterElement()
+			case isHTMLSpace(ch), ch == '/':
+			case ch == '=' && c.state == htmlStateAfterAttrName:
+				c.state = htmlStateBeforeValue
+			default:
+				c.state = htmlStateAttrName
+				c.attr = strings.ToLower(string(ch))
+			}
+		case htmlStateAttrName:
+			switch {
+			case ch == '>':
+				c.enterElement()
+			case ch == '=':
+				c.state = htmlStateBeforeValue
+			case isHTMLSpace(ch):
+				c.state = htmlStateAfterAttrName
+			case ch == '/':
+				c.state = htmlStateTag
+			default:
+				c.attr += strings.ToLower(string(ch))
+			}
+		case htmlStateBeforeValue:
+			switch {
+			case isHTMLSpace(ch):
+			case ch == '>':
+				c.enterElement()
+			case ch == '"', ch == '\'':
+				c.enterAttrValue(ch)
+			default:
+				c.enterAttrValue(0)
+				i = c.attrValueChar(s, i)
+			}
+		case htmlStateAttrValue:
+			switch {
+			case c.delim != 0 && ch == c.delim, c.delim == 0 && isHTMLSpace(ch):
+				c.state = htmlStateTag
+			case c.delim == 0 && ch == '>':
+				c.enterElement()
+			default:
+				i = c.attrValueChar(s, i)
+			}
+		case htmlStateScript:
+			if ch == '<' && hasPrefixFold(s[i:], "</script") {
+				c.state = htmlStateTagName
+				c.element = ""
+			} else {
+				i = c.jsChar(s, i)
+			}
+		case htmlStateStyle:
+			if ch == '<' && hasPrefixFold(s[i:], "</style") {
+				c.state = htmlStateTagName
+				c.element = ""
+			}
+		case htmlStateComment:
+			if strings.HasPrefix(s[i:], "-->") {
+				c.state = htmlStateText
+				i += 2
+			}
+		}
+	}
+	return c
+}
+
+// afterValue returns the context after a variable has been written at c.
+func (c escapeContext) afterValue() escapeContext {
+	if c.state == htmlStateBeforeValue {
+		c.enterAttrValue(0)
+	}
+	if c.state == htmlStateAttrValue && c.attrType == attrURL && c.url == urlPartNone {
+		c.url = urlPartPreQuery
+	}
+	return c
+}
+
+// canonical returns c without the fields which don't matter at its state (such
+// as the element of the last tag within text), so contexts can be compared.
+func (c escapeContext) canonical() escapeContext {
+	switch c.state {
+	case htmlStateText, htmlStateStyle, htmlStateComment:
+		return escapeContext{state: c.state}
+	case htmlStateScript:
+		return escapeContext{state: c.state, jsQuote: c.jsQuote, jsEscape: c.jsEscape, jsComment: c.jsComment}
+	case htmlStateAttrValue:
+		c.attr = ""
+		if c.attrType != attrURL {
+			c.url = urlPartNone
+		}
+		if c.attrType != attrScript {
+			c.jsQuote, c.jsEscape, c.jsComment = 0, false, 0
+		}
+		return c
+	}
+	// Within a tag
+	return escapeContext{state: c.state, element: c.element, attr: c.attr}
+}
+
+// enterElement is called at the end of a start or end tag.
+func (c *escapeContext) enterElement() {
+	switch c.element {
+	case "script":
+		c.state = htmlStateScript
+	case "style":
+		c.state = htmlStateStyle
+	default:
+		c.state = htmlStateText
+	}
+	c.attr = ""
+	c.jsQuote, c.jsEscape, c.jsComment = 0, false, 0
+}
+
+// enterAttrValue is called at the start of the value of the current attribute.
+func (c *escapeContext) enterAttrValue(delim byte) {
+	c.state = htmlStateAttrValue
+	c.delim = delim
+	c.url = urlPartNone
+	c.jsQuote, c.jsEscape, c.jsComment = 0, false, 0
+
+	name := c.attr
+	if idx := strings.IndexByte(name, ':'); idx >= 0 {
+		name = name[idx+1:] // e. g. xlink:href
+	}
+	switch {
+	case strings.HasPrefix(name, "on"):
+		c.attrType = attrScript
+	case name == "style":
+		c.attrType = attrStyle
+	case urlAttributes[name]:
+		c.attrType = attrURL
+	default:
+		c.attrType = attrNormal
+	}
+}
+
+// attrValueChar handles the character s[i] of an attribute value and returns
+// the index of the last character handled.
+func (c *escapeContext) attrValueChar(s string, i int) int {
+	switch c.attrType {
+	case attrURL:
+		if s[i] == '?' || s[i] == '#' {
+			c.url = urlPartQueryOrFrag
+		} else if c.url == urlPartNone {
+			c.url = urlPartPreQuery
+		}
+	case attrScript:
+		return c.jsChar(s, i)
+	}
+	return i
+}
+
+// jsChar handles the character s[i] of JavaScript code and returns the index
+// of the last character handled. Regular expression literals aren't recognized.
+func (c *escapeContext) jsChar(s string, i int) int {
+	ch := s[i]
+	switch {
+	case c.jsComment == '/':
+		if ch == '\n' {
+			c.jsComment = 0
+		}
+	case c.jsComment == '*':
+		if strings.HasPrefix(s[i:], "*/") {
+			c.jsComment = 0
+			i++
+		}
+	case c.jsQuote != 0:
+		switch {
+		case c.jsEscape:
+			c.jsEscape = false
+		case ch == '\\':
+			c.jsEscape = true
+		case ch == c.jsQuote:
+			c.jsQuote = 0
+		}
+	case ch == '"', ch == '\'', ch == '`':
+		c.jsQuote = ch
+	case strings.HasPrefix(s[i:], "//"), strings.HasPrefix(s[i:], "/*"):
+		c.jsComment = s[i+1]
+		i++
+	}
+	return i
+}
+
+// escape returns the string representation of value escaped for the context.
+// Values of html/template's safe types (such as template.HTML) are only written
+// as-is within a matching context.
+func (c escapeContext) escape(value *Value) string {
+	content, typ := value.htmlContent()
+
+	switch c.state {
+	case htmlStateScript:
+		if typ == c.jsContentType() {
+			return content
+		}
+		return c.escapeJS(value)
+	case htmlStateStyle:
+		if typ == contentCSS {
+			return content
+		}
+		return escapeCSS(value.String())
+	case htmlStateText, htmlStateComment:
+		if typ == contentHTML {
+			return content
+		}
+		return escapeReplacer.Replace(value.String())
+	case htmlStateBeforeValue, htmlStateAttrValue:
+		if c.state == htmlStateBeforeValue {
+			c.enterAttrValue(0)
+		}
+		var s string
+		switch c.attrType {
+		case attrURL:
+			s = value.String()
+			switch c.url {
+			case urlPartNone:
+				if typ != contentURL {
+					s = filterURL(s)
+				}
+				s = escapeURL(s, true)
+			case urlPartPreQuery:
+				s = escapeURL(s, true)
+			default:
+				s = escapeURL(s, false)
+			}
+		case attrScript:
+			if typ == c.jsContentType() {
+				s = content
+			} else {
+				s = c.escapeJS(value)
+			}
+		case attrStyle:
+			if typ == contentCSS {
+				s = content
+			} else {
+				s = escapeCSS(value.String())
+			}
+		default:
+			s = value.String()
+		}
+		if c.delim == 0 {
+			return escapeNospaceReplacer.Replace(s)
+		}
+		return escapeReplacer.Replace(s)
+	}
+	// Within a tag (attribute names, e. g. <div {{ attr }}>)
+	if typ == contentHTMLAttr {
+		return content
+	}
+	return escapeNospaceReplacer.Replace(value.String())
+}
+
+// jsContentType returns the type of safe content which can be written as-is
+// within JavaScript code at c.
+func (c escapeContext) jsContentType() contentType {
+	if c.jsQuote != 0 {
+		return contentJSStr
+	}
+	return contentJS
+}
+
+func (c escapeContext) escapeJS(value *Value) string {
+	if c.jsQuote != 0 {
+		return escapeJSString(value.String())
+	}
+	return escapeJSValue(value)
+}
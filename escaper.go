@@ -0,0 +1,138 @@
+package pongo2
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Escaper escapes the string values written by variable tags ({{ ... }}) if
+// autoescaping is enabled. Values marked as safe (using the safe filter or
+// AsSafeValue) aren't escaped.
+type Escaper interface {
+	Escape(s string) string
+}
+
+// EscaperFunc is an adapter to use a function as an Escaper.
+type EscaperFunc func(s string) string
+
+// Escape calls f(s).
+func (f EscaperFunc) Escape(s string) string {
+	return f(s)
+}
+
+// htmlEscaper escapes the HTML special characters (the default escaper).
+type htmlEscaper struct{}
+
+func (htmlEscaper) Escape(s string) string {
+	return escapeReplacer.Replace(s)
+}
+
+var latexReplacer = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	"{", `\{`,
+	"}", `\}`,
+	"$", `\$`,
+	"&", `\&`,
+	"#", `\#`,
+	"%", `\%`,
+	"_", `\_`,
+	"~", `\textasciitilde{}`,
+	"^", `\textasciicircum{}`,
+)
+
+// xmlReplacer escapes the characters with a special meaning in XML using the
+// predefined entities.
+var xmlReplacer = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"'", "&apos;",
+)
+
+// escapeShell returns s as a single-quoted word of a POSIX shell.
+func escapeShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// escapeYAML returns s as a double-quoted YAML scalar.
+func escapeYAML(s string) string {
+	b, _ := json.Marshal(s) // JSON strings are valid YAML scalars
+	return string(b)
+}
+
+var (
+	// escapers maps the escaping strategies to their implementations
+	escapers = map[string]Escaper{
+		"html":  htmlEscaper{},
+		"xml":   EscaperFunc(xmlReplacer.Replace),
+		"text":  EscaperFunc(func(s string) string { return s }),
+		"latex": EscaperFunc(latexReplacer.Replace),
+		"yaml":  EscaperFunc(escapeYAML),
+		"shell": EscaperFunc(escapeShell),
+	}
+
+	// escaperExtensions maps file extensions to escaping strategies (see
+	// TemplateSet.EscaperByExtension). Templates with other extensions (or
+	// created from strings) use the html strategy.
+	escaperExtensions = map[string]string{
+		".html":  "html",
+		".htm":   "html",
+		".xhtml": "html",
+		".xml":   "xml",
+		".svg":   "xml",
+		".txt":   "text",
+		".text":  "text",
+		".eml":   "text",
+		".tex":   "latex",
+		".latex": "latex",
+		".yaml":  "yaml",
+		".yml":   "yaml",
+		".sh":    "shell",
+	}
+)
+
+// EscaperExists returns true if the given escaping strategy is registered.
+func EscaperExists(name string) bool {
+	_, existing := escapers[name]
+	return existing
+}
+
+// RegisterEscaper registers a new escaping strategy which can be used in the
+// autoescape tag ({% autoescape name %}) and which is used for templates whose
+// filenames end with one of the given extensions (e. g. ".csv") in sets with
+// TemplateSet.EscaperByExtension enabled.
+func RegisterEscaper(name string, escaper Escaper, extensions ...string) error {
+	if EscaperExists(name) {
+		return fmt.Errorf("escaper with name '%s' is already registered", name)
+	}
+	escapers[name] = escaper
+	for _, ext := range extensions {
+		escaperExtensions[strings.ToLower(ext)] = name
+	}
+	return nil
+}
+
+// escaperForFile returns the escaper of the set for a template filename.
+func (set *TemplateSet) escaperForFile(name string) Escaper {
+	if set.Escaper != nil {
+		return set.Escaper
+	}
+	if !set.EscaperByExtension {
+		return htmlEscaper{}
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	strategy, has := set.escaperExtensions[ext]
+	if !has {
+		strategy, has = escaperExtensions[ext]
+	}
+	if has {
+		if escaper, found := set.getEscaper(strategy); found {
+			return escaper
+		}
+	}
+	return htmlEscaper{}
+}
@@ -82,6 +82,10 @@ func (fc *filterCall) Execute(v *Value, ctx *ExecutionContext) (*Value, *Error)
 	var param *Value
 	var err *Error
 
+	if err = ctx.countEvaluation(fc.token); err != nil {
+		return nil, err
+	}
+
 	if fc.parameter != nil {
 		param, err = fc.parameter.Evaluate(ctx)
 		if err != nil {
@@ -113,11 +117,16 @@ func (p *Parser) parseFilter() (*filterCall, *Error) {
 	}
 
 	// Get the appropriate filter function and bind it
-	filterFn, exists := filters[identToken.Val]
+	filterFn, exists := p.template.set.getFilter(identToken.Val)
 	if !exists {
 		return nil, p.Error(fmt.Sprintf("Filter '%s' does not exist.", identToken.Val), identToken)
 	}
 
+	// Check sandbox filter restriction
+	if !p.template.set.filterAllowed(identToken.Val) {
+		return nil, p.Error(fmt.Sprintf("Usage of filter '%s' is not allowed (sandbox restriction active).", identToken.Val), identToken)
+	}
+
 	filter.filterFunc = filterFn
 
 	// Check for filter-argument (2 tokens needed: ':' ARG)
@@ -126,12 +135,23 @@ func (p *Parser) parseFilter() (*filterCall, *Error) {
 			return nil, p.Error("Filter parameter required after ':'.", nil)
 		}
 
-		// Get filter argument expression
-		v, err := p.parseVariableOrLiteral()
-		if err != nil {
-			return nil, err
+		// Get filter argument expression; a parenthesized argument can be any expression
+		if p.Match(TokenSymbol, "(") != nil {
+			v, err := p.ParseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if p.Match(TokenSymbol, ")") == nil {
+				return nil, p.Error("Closing bracket expected after filter parameter.", nil)
+			}
+			filter.parameter = v
+		} else {
+			v, err := p.parseVariableOrLiteral()
+			if err != nil {
+				return nil, err
+			}
+			filter.parameter = v
 		}
-		filter.parameter = v
 	}
 
 	return filter, nil
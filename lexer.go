@@ -36,7 +36,7 @@ var (
 		"==", ">=", "<=", "&&", "||", "{{", "}}", "{%", "%}", "!=", "<>",
 
 		// 1-Char symbol
-		"(", ")", "+", "-", "*", "<", ">", "/", "^", ",", ".", "!", "|", ":", "=", "%", "[", "]",
+		"(", ")", "+", "-", "*", "<", ">", "/", "^", ",", ".", "!", "|", ":", "=", "%", "[", "]", "{", "}",
 	}
 
 	// Available keywords in pongo2
@@ -72,6 +72,10 @@ type (
 
 		inVerbatim   bool
 		verbatimName string
+
+		// Number of open braces of dictionary literals within the current
+		// tag/variable; a '}' closes a dictionary before it ends the tag (e. g. {{ {"a": 1}}})
+		openBraces int
 	}
 )
 
@@ -346,12 +350,23 @@ outer_loop:
 		// Check for symbol
 		for _, sym := range TokenSymbols {
 			if strings.HasPrefix(l.input[l.start:], sym) {
+				if sym == "}}" && l.openBraces > 0 {
+					sym = "}"
+				}
+				switch sym {
+				case "{":
+					l.openBraces++
+				case "}":
+					l.openBraces--
+				}
+
 				l.pos += len(sym)
 				l.col += l.length()
 				l.emit(TokenSymbol)
 
 				if sym == "%}" || sym == "-%}" || sym == "}}" || sym == "-}}" {
 					// Tag/variable end, return after emit
+					l.openBraces = 0
 					return nil
 				}
 
@@ -0,0 +1,117 @@
+package pongo2
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Limits restrict the resources a single template execution may use. They're
+// useful when executing user-provided templates. A zero value for any of the
+// fields means there's no limit.
+//
+// Limits are configured through Options, either for a whole TemplateSet
+// (set.Options.Limits) or for a specific template (tpl.Options.Limits).
+// The limits of the executed template apply to all templates it includes.
+type Limits struct {
+	// MaxOutputBytes is the maximum amount of bytes a template may write.
+	MaxOutputBytes int
+
+	// MaxLoopIterations is the maximum number of iterations of all
+	// for-loops (including nested ones) of an execution in total.
+	MaxLoopIterations int
+
+	// MaxIncludeDepth is the maximum nesting level of included templates.
+	MaxIncludeDepth int
+
+	// MaxEvaluations is the maximum number of evaluated expressions
+	// (variable lookups, filter calls and operators).
+	MaxEvaluations int
+}
+
+// The errors wrapped by the *Error returned from an execution which exceeded
+// one of its Limits. Use errors.Is to check for them.
+var (
+	ErrOutputLimitExceeded     = errors.New("maximum output size exceeded")
+	ErrLoopLimitExceeded       = errors.New("maximum number of loop iterations exceeded")
+	ErrIncludeDepthExceeded    = errors.New("maximum include depth exceeded")
+	ErrEvaluationLimitExceeded = errors.New("maximum number of evaluations exceeded")
+)
+
+// executionState is shared between all ExecutionContexts of a single
+// execution (including the ones of included templates).
+type executionState struct {
+	limits Limits
+
+	outputBytes int
+	iterations  int
+	evaluations int
+
+	// writeErr is set by the limitedTemplateWriter; it's reported by the next
+	// check of the executing nodes since writer errors aren't propagated.
+	writeErr error
+
+	// nodeStates holds the state of nodes like cycle and ifchanged for this
+	// execution (nodes are shared between executions and must not be modified)
+	nodeStates map[INode]any
+}
+
+func (ctx *ExecutionContext) countIteration(token *Token) *Error {
+	limit := ctx.state.limits.MaxLoopIterations
+	if limit <= 0 {
+		return nil
+	}
+	ctx.state.iterations++
+	if ctx.state.iterations > limit {
+		return ctx.OrigError(fmt.Errorf("%w (max is %d)", ErrLoopLimitExceeded, limit), token)
+	}
+	return nil
+}
+
+func (ctx *ExecutionContext) countEvaluation(token *Token) *Error {
+	limit := ctx.state.limits.MaxEvaluations
+	if limit <= 0 {
+		return nil
+	}
+	ctx.state.evaluations++
+	if ctx.state.evaluations > limit {
+		return ctx.OrigError(fmt.Errorf("%w (max is %d)", ErrEvaluationLimitExceeded, limit), token)
+	}
+	return nil
+}
+
+// limitedTemplateWriter refuses to write more than Limits.MaxOutputBytes.
+type limitedTemplateWriter struct {
+	w     TemplateWriter
+	state *executionState
+}
+
+func (lw *limitedTemplateWriter) reserve(n int) error {
+	if lw.state.writeErr != nil {
+		return lw.state.writeErr
+	}
+	limit := lw.state.limits.MaxOutputBytes
+	if lw.state.outputBytes+n > limit {
+		lw.state.writeErr = fmt.Errorf("%w (max is %d bytes)", ErrOutputLimitExceeded, limit)
+		return lw.state.writeErr
+	}
+	lw.state.outputBytes += n
+	return nil
+}
+
+func (lw *limitedTemplateWriter) Write(b []byte) (int, error) {
+	if err := lw.reserve(len(b)); err != nil {
+		return 0, err
+	}
+	return lw.w.Write(b)
+}
+
+func (lw *limitedTemplateWriter) WriteString(s string) (int, error) {
+	if err := lw.reserve(len(s)); err != nil {
+		return 0, err
+	}
+	return lw.w.WriteString(s)
+}
+
+func (lw *limitedTemplateWriter) WriteAny(v *Value) (int, error) {
+	return lw.WriteString(v.String())
+}
@@ -0,0 +1,22 @@
+package pongo2
+
+// namespace is a mutable object created by namespace() in templates. Its
+// attributes can be assigned using {% set ns.attribute = value %}, even from
+// within a for-loop or another scope (see tagSetNode).
+type namespace map[string]*Value
+
+// newNamespace is available as namespace() in all templates, e. g.
+// {% set ns = namespace(count=0, found=false) %}.
+func newNamespace(kwargs Kwargs) namespace {
+	ns := make(namespace, len(kwargs))
+	for name, value := range kwargs {
+		ns[name] = copyValue(value)
+	}
+	return ns
+}
+
+// builtinFunctions are available to all templates unless the context
+// provides a value with the same name.
+var builtinFunctions = Context{
+	"namespace": newNamespace,
+}
@@ -6,11 +6,29 @@ type nodeDocument struct {
 }
 
 func (doc *nodeDocument) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	return doc.execute(ctx, writer, nil)
+}
+
+// execute runs the nodes of the document and calls afterNode (if not nil)
+// after each of them.
+func (doc *nodeDocument) execute(ctx *ExecutionContext, writer TemplateWriter, afterNode func(*ExecutionContext, INode) *Error) *Error {
 	for _, n := range doc.Nodes {
+		if err := ctx.checkAborted(nil); err != nil {
+			return err
+		}
 		err := n.Execute(ctx, writer)
 		if err != nil {
 			return err
 		}
+		if afterNode != nil {
+			if err := afterNode(ctx, n); err != nil {
+				return err
+			}
+		}
+		if ctx.loopControl.interrupted() {
+			// Skip the remaining nodes due to a {% break %} or {% continue %}
+			return nil
+		}
 	}
 	return nil
 }
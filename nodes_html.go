@@ -5,13 +5,28 @@ import (
 )
 
 type nodeHTML struct {
+	template  *Template
 	token     *Token
 	trimLeft  bool
 	trimRight bool
+
+	// For the TrimBlocks and LStripBlocks options of the template; the token
+	// itself is never modified since the template might be executed concurrently.
+	afterTag  bool // the token follows a tag ({% ... %})
+	beforeTag bool // the token is followed by a tag
 }
 
 func (n *nodeHTML) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
 	res := n.token.Val
+	if n.afterTag && n.template.Options.TrimBlocks {
+		// Issue #94 https://github.com/flosch/pongo2/issues/94
+		// If an application configures pongo2 template to trim_blocks,
+		// the first newline after a template tag is removed automatically (like in PHP).
+		res = strings.TrimPrefix(res, "\n")
+	}
+	if n.beforeTag && n.template.Options.LStripBlocks {
+		res = strings.TrimRight(res, "\t ")
+	}
 	if n.trimLeft {
 		res = strings.TrimLeft(res, tokenSpaceChars)
 	}
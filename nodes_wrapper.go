@@ -7,10 +7,17 @@ type NodeWrapper struct {
 
 func (wrapper *NodeWrapper) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
 	for _, n := range wrapper.nodes {
+		if err := ctx.checkAborted(nil); err != nil {
+			return err
+		}
 		err := n.Execute(ctx, writer)
 		if err != nil {
 			return err
 		}
+		if ctx.loopControl.interrupted() {
+			// Skip the remaining nodes due to a {% break %} or {% continue %}
+			return nil
+		}
 	}
 	return nil
 }
@@ -1,5 +1,38 @@
 package pongo2
 
+// UndefinedPolicy defines how undefined variables (unknown names, missing struct
+// fields or map keys and out-of-range indexes) are handled during execution.
+type UndefinedPolicy int
+
+const (
+	// UndefinedSilent evaluates undefined variables to nil (the default).
+	UndefinedSilent UndefinedPolicy = iota
+
+	// UndefinedLog evaluates undefined variables to nil and logs their location.
+	UndefinedLog
+
+	// UndefinedError aborts the execution with an error wrapping ErrUndefinedVariable.
+	UndefinedError
+)
+
+// AutoescapeMode defines how values are escaped if autoescaping is enabled.
+type AutoescapeMode int
+
+const (
+	// AutoescapeHTML escapes the HTML special characters of string values (the default).
+	AutoescapeHTML AutoescapeMode = iota
+
+	// AutoescapeContextual escapes values depending on their position within the HTML
+	// document (text, quoted or unquoted attribute values, URL attributes such as href,
+	// event handler attributes, style attributes and script or style elements), similar
+	// to html/template. The HTML context is determined when the template is compiled.
+	// It applies to variables and to the output of the firstof and call tags. Blocks
+	// overriding a block of a parent are escaped for the context of the parent's block;
+	// with a dynamic parent ({% extends layout %}), the execution fails if the contexts
+	// differ.
+	AutoescapeContextual
+)
+
 // Options allow you to change the behavior of template-engine.
 // You can change the options before calling the Execute method.
 type Options struct {
@@ -12,6 +45,25 @@ type Options struct {
 	// If this is set to true, all unnecessary whitespace is stripped from the template.
 	// This includes whitespace between tags and whitespace in HTML tags, but preserves whitespace inside attribute values.
 	TrimWhitespace bool
+
+	// If this is set to true, struct fields can be accessed by the name of their `json` struct tag
+	// if neither a `pongo2` struct tag nor a field with the given name exists. Defaults to false.
+	JSONTagFallback bool
+
+	// Undefined defines how undefined variables are handled. Defaults to UndefinedSilent.
+	// Variables filtered by `default` (or `default_if_none`) and the operands of the `defined`
+	// and `undefined` tests are never treated as errors.
+	Undefined UndefinedPolicy
+
+	// Limits restrict the resources an execution of the template may use. No limits are set by default.
+	Limits Limits
+
+	// If this is set to true, values aren't escaped unless the autoescape tag enables it. Defaults to
+	// false (values are escaped using the template's Escaper).
+	DisableAutoescape bool
+
+	// AutoescapeMode defines how values are escaped if autoescaping is enabled. Defaults to AutoescapeHTML.
+	AutoescapeMode AutoescapeMode
 }
 
 func newOptions() *Options {
@@ -27,6 +79,11 @@ func (opt *Options) Update(other *Options) *Options {
 	opt.TrimBlocks = other.TrimBlocks
 	opt.LStripBlocks = other.LStripBlocks
 	opt.TrimWhitespace = other.TrimWhitespace
+	opt.JSONTagFallback = other.JSONTagFallback
+	opt.Undefined = other.Undefined
+	opt.Limits = other.Limits
+	opt.DisableAutoescape = other.DisableAutoescape
+	opt.AutoescapeMode = other.AutoescapeMode
 
 	return opt
 }
@@ -39,6 +39,12 @@ type Parser struct {
 	// For TrimWhitespace option
 	htmlInQuote  rune
 	htmlLastChar rune
+
+	// HTML context of the current position (for contextual autoescaping)
+	escapeContext escapeContext
+
+	// macro whose body is being parsed (if any); see tagMacroNode.catchVarargs
+	macro *tagMacroNode
 }
 
 // Creates a new parser to parse tokens.
@@ -243,7 +249,9 @@ func (p *Parser) WrapUntilTag(names ...string) (*NodeWrapper, *Parser, *Error) {
 						if p.Match(TokenSymbol, "%}") != nil {
 							// Okay, end the wrapping here
 							wrapper.Endtag = tagIdent.Val
-							return wrapper, newParser(p.template.name, tagArgs, p.template), nil
+							endParser := newParser(p.template.name, tagArgs, p.template)
+							endParser.macro = p.macro
+							return wrapper, endParser, nil
 						}
 						t := p.Current()
 						p.Consume()
@@ -9,11 +9,14 @@ func (p *Parser) parseDocElement() (INode, *Error) {
 		if p.template.Options.TrimWhitespace {
 			t.Val, p.htmlInQuote, p.htmlLastChar = stripWhitespace(t.Val, p.htmlInQuote, p.htmlLastChar)
 		}
-		n := &nodeHTML{token: t}
+		p.escapeContext = p.escapeContext.advance(t.Val)
+		n := &nodeHTML{template: p.template, token: t}
 		left := p.PeekTypeN(-1, TokenSymbol)
 		right := p.PeekTypeN(1, TokenSymbol)
 		n.trimLeft = left != nil && left.TrimWhitespaces
 		n.trimRight = right != nil && right.TrimWhitespaces
+		n.afterTag = left != nil && left.Val == "%}"
+		n.beforeTag = right != nil && right.Val == "{%"
 		p.Consume() // consume HTML element
 		return n, nil
 	case TokenSymbol:
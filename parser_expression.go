@@ -12,6 +12,13 @@ type Expression struct {
 	opToken *Token
 }
 
+type conditionalExpression struct {
+	trueExpr  IEvaluator
+	condition IEvaluator
+	falseExpr IEvaluator // nil if there's no else-branch
+	opToken   *Token
+}
+
 type relationalExpression struct {
 	// TODO: Add location token?
 	expr1   IEvaluator
@@ -45,6 +52,11 @@ func (expr *Expression) FilterApplied(name string) bool {
 		(expr.expr2 != nil && expr.expr2.FilterApplied(name)))
 }
 
+func (expr *conditionalExpression) FilterApplied(name string) bool {
+	return expr.trueExpr.FilterApplied(name) && (expr.falseExpr == nil ||
+		expr.falseExpr.FilterApplied(name))
+}
+
 func (expr *relationalExpression) FilterApplied(name string) bool {
 	return expr.expr1.FilterApplied(name) && (expr.expr2 == nil ||
 		(expr.expr2 != nil && expr.expr2.FilterApplied(name)))
@@ -69,6 +81,10 @@ func (expr *Expression) GetPositionToken() *Token {
 	return expr.expr1.GetPositionToken()
 }
 
+func (expr *conditionalExpression) GetPositionToken() *Token {
+	return expr.trueExpr.GetPositionToken()
+}
+
 func (expr *relationalExpression) GetPositionToken() *Token {
 	return expr.expr1.GetPositionToken()
 }
@@ -94,6 +110,15 @@ func (expr *Expression) Execute(ctx *ExecutionContext, writer TemplateWriter) *E
 	return nil
 }
 
+func (expr *conditionalExpression) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	value, err := expr.Evaluate(ctx)
+	if err != nil {
+		return err
+	}
+	writer.WriteAny(value)
+	return nil
+}
+
 func (expr *relationalExpression) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
 	value, err := expr.Evaluate(ctx)
 	if err != nil {
@@ -131,6 +156,9 @@ func (expr *power) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error
 }
 
 func (expr *Expression) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
+	if err := ctx.countEvaluation(expr.opToken); err != nil {
+		return nil, err
+	}
 	v1, err := expr.expr1.Evaluate(ctx)
 	if err != nil {
 		return nil, err
@@ -165,7 +193,28 @@ func (expr *Expression) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 	}
 }
 
+func (expr *conditionalExpression) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
+	if err := ctx.countEvaluation(expr.opToken); err != nil {
+		return nil, err
+	}
+	cond, err := expr.condition.Evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Only the selected branch is evaluated
+	if cond.IsTrue() {
+		return expr.trueExpr.Evaluate(ctx)
+	}
+	if expr.falseExpr == nil {
+		return AsValue(nil), nil
+	}
+	return expr.falseExpr.Evaluate(ctx)
+}
+
 func (expr *relationalExpression) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
+	if err := ctx.countEvaluation(expr.opToken); err != nil {
+		return nil, err
+	}
 	v1, err := expr.expr1.Evaluate(ctx)
 	if err != nil {
 		return nil, err
@@ -225,6 +274,9 @@ func (expr *relationalExpression) Evaluate(ctx *ExecutionContext) (*Value, *Erro
 }
 
 func (expr *simpleExpression) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
+	if err := ctx.countEvaluation(expr.GetPositionToken()); err != nil {
+		return nil, err
+	}
 	t1, err := expr.term1.Evaluate(ctx)
 	if err != nil {
 		return nil, err
@@ -283,6 +335,9 @@ func (expr *simpleExpression) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 }
 
 func (expr *term) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
+	if err := ctx.countEvaluation(expr.opToken); err != nil {
+		return nil, err
+	}
 	f1, err := expr.factor1.Evaluate(ctx)
 	if err != nil {
 		return nil, err
@@ -331,6 +386,9 @@ func (expr *term) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 }
 
 func (expr *power) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
+	if err := ctx.countEvaluation(expr.GetPositionToken()); err != nil {
+		return nil, err
+	}
 	p1, err := expr.power1.Evaluate(ctx)
 	if err != nil {
 		return nil, err
@@ -346,18 +404,30 @@ func (expr *power) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 }
 
 func (p *Parser) parseFactor() (IEvaluator, *Error) {
+	var expr IEvaluator
+	var err *Error
+
 	if p.Match(TokenSymbol, "(") != nil {
-		expr, err := p.ParseExpression()
+		expr, err = p.ParseExpression()
 		if err != nil {
 			return nil, err
 		}
 		if p.Match(TokenSymbol, ")") == nil {
 			return nil, p.Error("Closing bracket expected after expression", nil)
 		}
-		return expr, nil
+	} else {
+		expr, err = p.parseVariableOrLiteralWithFilter()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Tests (expr is [not] test) bind as tight as filters
+	if p.Match(TokenIdentifier, "is") != nil {
+		return p.parseTest(expr)
 	}
 
-	return p.parseVariableOrLiteralWithFilter()
+	return expr, nil
 }
 
 func (p *Parser) parsePower() (IEvaluator, *Error) {
@@ -503,7 +573,49 @@ func (p *Parser) parseRelationalExpression() (IEvaluator, *Error) {
 	return expr, nil
 }
 
+// ParseExpression parses an expression including inline conditionals
+// (`expr if condition else expr`).
 func (p *Parser) ParseExpression() (IEvaluator, *Error) {
+	expr, err := p.parseOrExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	ifToken := p.Match(TokenIdentifier, "if")
+	if ifToken == nil {
+		return expr, nil
+	}
+
+	if p.Remaining() == 0 {
+		return nil, p.Error("Unexpected EOF, expected a condition after 'if'.", p.lastToken)
+	}
+	condition, err := p.parseOrExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	cexpr := &conditionalExpression{
+		trueExpr:  expr,
+		condition: condition,
+		opToken:   ifToken,
+	}
+
+	if p.Match(TokenIdentifier, "else") != nil {
+		if p.Remaining() == 0 {
+			return nil, p.Error("Unexpected EOF, expected an expression after 'else'.", p.lastToken)
+		}
+		falseExpr, err := p.ParseExpression()
+		if err != nil {
+			return nil, err
+		}
+		cexpr.falseExpr = falseExpr
+	}
+
+	return cexpr, nil
+}
+
+// parseOrExpression parses an expression without an inline conditional.
+func (p *Parser) parseOrExpression() (IEvaluator, *Error) {
 	rexpr1, err := p.parseRelationalExpression()
 	if err != nil {
 		return nil, err
@@ -516,7 +628,7 @@ func (p *Parser) ParseExpression() (IEvaluator, *Error) {
 	if p.PeekOne(TokenSymbol, "&&", "||") != nil || p.PeekOne(TokenKeyword, "and", "or") != nil {
 		op := p.Current()
 		p.Consume()
-		expr2, err := p.ParseExpression()
+		expr2, err := p.parseOrExpression()
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,121 @@
+package pongo2_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anton7r/pongo2/v6"
+)
+
+func TestExecuteContext(t *testing.T) {
+	tpl, err := pongo2.FromString("{% for i in items %}{{ i }}{% endfor %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.ExecuteContext(context.Background(), pongo2.Context{"items": []int{1, 2, 3}}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "123" {
+		t.Fatalf("Expected '123', got '%s'", buf.String())
+	}
+}
+
+func TestExecuteContextCanceled(t *testing.T) {
+	tpl, err := pongo2.FromString("{% for i in items %}{{ check(i) }}{% endfor %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	var buf bytes.Buffer
+	err = tpl.ExecuteContext(ctx, pongo2.Context{
+		"items": make([]int, 1000),
+		"check": func(i int) int {
+			calls++
+			if calls == 10 {
+				cancel()
+			}
+			return i
+		},
+	}, &buf)
+	if err == nil {
+		t.Fatal("Expected an error, got none")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got: %v", err)
+	}
+	var perr *pongo2.Error
+	if !errors.As(err, &perr) || perr.Line != 1 {
+		t.Fatalf("Expected a *pongo2.Error with location information, got: %#v", err)
+	}
+	if calls != 10 {
+		t.Fatalf("Expected execution to stop after 10 calls, got %d", calls)
+	}
+	if buf.Len() > 0 {
+		t.Fatalf("Expected no output on error, got '%s'", buf.String())
+	}
+}
+
+func TestExecuteContextDeadline(t *testing.T) {
+	tpl, err := pongo2.FromString("{% for i in items %}{% for j in items %}{{ slow() }}{% endfor %}{% endfor %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err = tpl.ExecuteContextUnbuffered(ctx, pongo2.Context{
+		"items": make([]int, 1000),
+		"slow": func() string {
+			time.Sleep(time.Millisecond)
+			return "."
+		},
+	}, &bytes.Buffer{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got: %v", err)
+	}
+}
+
+func TestExecuteContextSet(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	err := testSuite2.ExecuteContext(ctx, "template_tests/includes.tpl", tplContext, &buf)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestGoContextInFunction(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request-value")
+
+	tpl, err := pongo2.FromString("{{ fromctx() }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = tpl.ExecuteContext(ctx, pongo2.Context{
+		"fromctx": func(ectx *pongo2.ExecutionContext) string {
+			return ectx.GoContext().Value(ctxKey{}).(string)
+		},
+	}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "request-value") {
+		t.Fatalf("Expected 'request-value', got '%s'", buf.String())
+	}
+}
@@ -0,0 +1,126 @@
+package pongo2_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/anton7r/pongo2/v6"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		limits   pongo2.Limits
+		context  pongo2.Context
+		err      error
+	}{
+		{
+			name:     "OutputBytes",
+			template: "{% for i in items %}{{ i }}abc{% endfor %}",
+			limits:   pongo2.Limits{MaxOutputBytes: 100},
+			context:  pongo2.Context{"items": make([]int, 100)},
+			err:      pongo2.ErrOutputLimitExceeded,
+		},
+		{
+			name:     "OutputBytesLastWrite",
+			template: "{{ text }}",
+			limits:   pongo2.Limits{MaxOutputBytes: 10},
+			context:  pongo2.Context{"text": strings.Repeat("x", 11)},
+			err:      pongo2.ErrOutputLimitExceeded,
+		},
+		{
+			name:     "LoopIterations",
+			template: "{% for i in items %}{% for j in items %}{% endfor %}{% endfor %}",
+			limits:   pongo2.Limits{MaxLoopIterations: 50},
+			context:  pongo2.Context{"items": make([]int, 10)},
+			err:      pongo2.ErrLoopLimitExceeded,
+		},
+		{
+			name:     "Evaluations",
+			template: "{% for i in items %}{{ i + 1 }}{% endfor %}",
+			limits:   pongo2.Limits{MaxEvaluations: 20},
+			context:  pongo2.Context{"items": make([]int, 10)},
+			err:      pongo2.ErrEvaluationLimitExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpl, err := testSuite2.FromString(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tpl.Options.Limits = tt.limits
+			out, err := tpl.Execute(tt.context)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error '%v', got: %v", tt.err, err)
+			}
+			if out != "" {
+				t.Fatalf("Expected no output, got '%s'", out)
+			}
+		})
+	}
+}
+
+func TestLimitsWithinBounds(t *testing.T) {
+	tpl, err := testSuite2.FromString("{% for i in items %}{{ i }}{% endfor %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.Options.Limits = pongo2.Limits{
+		MaxOutputBytes:    3,
+		MaxLoopIterations: 3,
+		MaxEvaluations:    4,
+	}
+	out, err := tpl.Execute(pongo2.Context{"items": []int{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "123" {
+		t.Fatalf("Expected '123', got '%s'", out)
+	}
+}
+
+func TestLimitsExecuteBlocks(t *testing.T) {
+	tpl, err := testSuite2.FromString("{% block a %}{{ text }}{% endblock %}{% block b %}{{ text }}{% endblock %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.Options.Limits = pongo2.Limits{MaxOutputBytes: 15}
+	_, err = tpl.ExecuteBlocks(pongo2.Context{"text": strings.Repeat("x", 10)}, []string{"a", "b"})
+	if !errors.Is(err, pongo2.ErrOutputLimitExceeded) {
+		t.Fatalf("Expected ErrOutputLimitExceeded, got: %v", err)
+	}
+}
+
+func TestLimitsLoopBreak(t *testing.T) {
+	// The item following a {% break %} must not count as an iteration.
+	tpl, err := testSuite2.FromString("{% for i in items %}{% if i == 2 %}{% break %}{% endif %}{{ i }}{% endfor %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.Options.Limits = pongo2.Limits{MaxLoopIterations: 3}
+	out, err := tpl.Execute(pongo2.Context{"items": []int{0, 1, 2, 3, 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "01" {
+		t.Fatalf("Expected '01', got '%s'", out)
+	}
+}
+
+func TestLimitsIncludeDepth(t *testing.T) {
+	set := pongo2.NewSet("limits", pongo2.MustNewLocalFileSystemLoader("template_tests/limits"))
+	set.Options.Limits.MaxIncludeDepth = 5
+
+	// The recursive include is resolved lazily, otherwise compiling would not terminate.
+	tpl, err := set.FromString(`{% include name %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Execute(pongo2.Context{"name": "recursive_lazy.tpl"})
+	if !errors.Is(err, pongo2.ErrIncludeDepthExceeded) {
+		t.Fatalf("Expected ErrIncludeDepthExceeded, got: %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package pongo2_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/anton7r/pongo2/v6"
+)
+
+func newSandboxTestDir(t *testing.T) (string, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	base := filepath.Join(root, "templates")
+	outside := filepath.Join(root, "secret.txt")
+
+	files := map[string]string{
+		outside:                           "secret",
+		filepath.Join(base, "index.html"): "index",
+		filepath.Join(base, "partials", "a.html"):  "partial",
+		filepath.Join(base, "partials", "b.txt"):   "text",
+		filepath.Join(base, "ssi.html"):            `{% ssi "partials/b.txt" %}`,
+		filepath.Join(base, "ssi_escape.html"):     `{% ssi "../secret.txt" %}`,
+		filepath.Join(base, "include_escape.html"): `{% include "../secret.txt" %}`,
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(base, "link.html")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	return base, outside
+}
+
+func TestSandboxedFilesystemLoader(t *testing.T) {
+	base, outside := newSandboxTestDir(t)
+
+	loader := pongo2.MustNewSandboxedFilesystemLoader(base)
+	set := pongo2.NewSet("sandboxed", loader)
+
+	for name, want := range map[string]string{
+		"index.html":                      "index",
+		"partials/a.html":                 "partial",
+		filepath.Join(base, "index.html"): "index",
+		"ssi.html":                        "text",
+	} {
+		out, err := set.RenderTemplateFile(name, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out != want {
+			t.Fatalf("%s: expected '%s', got '%s'", name, want, out)
+		}
+	}
+
+	for _, name := range []string{
+		"../secret.txt",
+		"partials/../../secret.txt",
+		outside,
+		"link.html",
+		"ssi_escape.html",
+		"include_escape.html",
+	} {
+		_, err := set.FromFile(name)
+		if !errors.Is(err, pongo2.ErrSandboxViolation) {
+			t.Fatalf("%s: expected ErrSandboxViolation, got: %v", name, err)
+		}
+	}
+}
+
+func TestSandboxedFilesystemLoaderPatterns(t *testing.T) {
+	base, _ := newSandboxTestDir(t)
+
+	loader := pongo2.MustNewSandboxedFilesystemLoader(base)
+	if err := loader.AllowPatterns("[", "*.html"); err == nil {
+		t.Fatal("Expected an error for an invalid pattern")
+	}
+	if err := loader.AllowPatterns("partials/*.html"); err != nil {
+		t.Fatal(err)
+	}
+	set := pongo2.NewSet("sandboxed patterns", loader)
+
+	if _, err := set.FromFile("partials/a.html"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"index.html", "partials/b.txt"} {
+		_, err := set.FromFile(name)
+		if !errors.Is(err, pongo2.ErrSandboxViolation) {
+			t.Fatalf("%s: expected ErrSandboxViolation, got: %v", name, err)
+		}
+	}
+}
+
+func TestSandboxedFilesystemLoaderRequiresBaseDir(t *testing.T) {
+	if _, err := pongo2.NewSandboxedFilesystemLoader(""); err == nil {
+		t.Fatal("Expected an error without base directory")
+	}
+}
+
+func TestTemplateSetAllowLists(t *testing.T) {
+	set := pongo2.NewSet("allow lists", pongo2.MustNewLocalFileSystemLoader(""))
+	if err := set.AllowTags("if", "for"); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.AllowFilters("upper"); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.AllowFilters("does_not_exist"); err == nil {
+		t.Fatal("Expected an error when allowing an unknown filter")
+	}
+
+	tpl, err := set.FromString("{% for x in items %}{% if x %}{{ x|upper }}{% endif %}{% endfor %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(pongo2.Context{"items": []string{"a", "", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "AB" {
+		t.Fatalf("Unexpected output: %q", out)
+	}
+
+	for _, tc := range []string{
+		"{{ x|lower }}",
+		"{% with y=x %}{{ y }}{% endwith %}",
+		"{% filter lower %}X{% endfilter %}",
+	} {
+		if _, err := set.FromString(tc); err == nil {
+			t.Fatalf("%s: expected a sandbox error", tc)
+		}
+	}
+
+	if err := set.AllowTags("with"); err == nil {
+		t.Fatal("Expected an error when changing the allow-list after the first template")
+	}
+}
+
+func TestTemplateSetBannedFilterTag(t *testing.T) {
+	set := pongo2.NewSet("banned filter tag", pongo2.MustNewLocalFileSystemLoader(""))
+	if err := set.BanFilter("lower"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := set.FromString("{% filter lower %}X{% endfilter %}"); err == nil {
+		t.Fatal("Expected a sandbox error for a banned filter within the filter tag")
+	}
+}
+
+func TestTemplateSetRegistries(t *testing.T) {
+	web := pongo2.NewSet("web", pongo2.MustNewLocalFileSystemLoader(""))
+	email := pongo2.NewSet("email", pongo2.MustNewLocalFileSystemLoader(""))
+
+	shout := func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue(in.String() + "!"), nil
+	}
+	if err := web.RegisterFilter("shout", shout); err != nil {
+		t.Fatal(err)
+	}
+	if err := web.RegisterFilter("shout", shout); err == nil {
+		t.Fatal("Expected an error when registering a filter twice")
+	}
+	if err := web.RegisterFilter("upper", shout); err == nil {
+		t.Fatal("Expected an error when shadowing a global filter")
+	}
+	if err := web.RegisterTag("nothing", func(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, *pongo2.Error) {
+		return nothingNode{}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if pongo2.FilterExists("shout") {
+		t.Fatal("Per-set filter leaked into the global registry")
+	}
+
+	tpl, err := web.FromString("{{ \"hi\"|shout }}{% nothing %}{% filter shout %}ho{% endfilter %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "hi!ho!" {
+		t.Fatalf("Unexpected output: %q", out)
+	}
+
+	if _, err := email.FromString("{{ \"hi\"|shout }}"); err == nil {
+		t.Fatal("Expected an error for a filter registered in another set")
+	}
+	if _, err := email.FromString("{% nothing %}"); err == nil {
+		t.Fatal("Expected an error for a tag registered in another set")
+	}
+	if err := web.RegisterFilter("late", shout); err == nil {
+		t.Fatal("Expected an error when registering a filter after the first template")
+	}
+}
+
+type nothingNode struct{}
+
+func (nothingNode) Execute(*pongo2.ExecutionContext, pongo2.TemplateWriter) *pongo2.Error {
+	return nil
+}
+
+type policyUser struct {
+	Name     string `pongo2:"name"`
+	Password string
+}
+
+func (u policyUser) Greeting() string { return "Hello " + u.Name }
+
+func (u *policyUser) Reset() string { return "reset" }
+
+func TestAccessPolicy(t *testing.T) {
+	user := &policyUser{Name: "flosch", Password: "secret"}
+
+	tests := []struct {
+		policy *pongo2.AccessPolicy
+		tpl    string
+		out    string
+		denied string
+	}{
+		{nil, "{{ user.Greeting }} {{ user.Password }}", "Hello flosch secret", ""},
+		{&pongo2.AccessPolicy{DenyMethods: true}, "{{ user.Name }}", "flosch", ""},
+		{&pongo2.AccessPolicy{DenyMethods: true}, "{{ user.Greeting }}", "", "Greeting"},
+		{&pongo2.AccessPolicy{AllowedMethods: map[reflect.Type][]string{
+			reflect.TypeOf(policyUser{}): {"Greeting"},
+		}}, "{{ user.Greeting }}", "Hello flosch", ""},
+		{&pongo2.AccessPolicy{AllowedMethods: map[reflect.Type][]string{
+			reflect.TypeOf(policyUser{}): {"Greeting"},
+		}}, "{{ user.Reset }}", "", "Reset"},
+		{&pongo2.AccessPolicy{RequireFieldTag: true}, "{{ user.Name }}", "flosch", ""},
+		{&pongo2.AccessPolicy{RequireFieldTag: true}, "{{ user.Password }}", "", "Password"},
+		{&pongo2.AccessPolicy{RequireFieldTag: true}, `{{ user["Password"] }}`, "", "Password"},
+	}
+
+	for _, test := range tests {
+		set := pongo2.NewSet("access policy", pongo2.MustNewLocalFileSystemLoader(""))
+		set.AccessPolicy = test.policy
+
+		tpl, err := set.FromString(test.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(pongo2.Context{"user": user})
+		if test.denied == "" {
+			if err != nil {
+				t.Fatalf("%s: %v", test.tpl, err)
+			}
+			if out != test.out {
+				t.Fatalf("%s: unexpected output %q", test.tpl, out)
+			}
+			continue
+		}
+		if !errors.Is(err, pongo2.ErrAccessDenied) {
+			t.Fatalf("%s: expected ErrAccessDenied, got: %v", test.tpl, err)
+		}
+		if !strings.Contains(err.Error(), "'"+test.denied+"'") {
+			t.Fatalf("%s: error doesn't name the denied member: %v", test.tpl, err)
+		}
+	}
+}
@@ -204,6 +204,16 @@ Yep!`,
 			}
 			return true
 		},
+		"func_kwargs": func(label string, kwargs pongo2.Kwargs) string {
+			size := 1
+			if v, has := kwargs["size"]; has {
+				size = v.Integer()
+			}
+			return fmt.Sprintf("%s (size %d, %d kwargs)", label, size, len(kwargs))
+		},
+		"func_kwargs_variadic": func(kwargs pongo2.Kwargs, args ...*pongo2.Value) string {
+			return fmt.Sprintf("%d args, %d kwargs", len(args), len(kwargs))
+		},
 	},
 	"complex": map[string]any{
 		"is_admin": isAdmin,
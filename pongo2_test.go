@@ -1,13 +1,20 @@
 package pongo2_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/anton7r/pongo2/v6"
 )
@@ -161,3 +168,1070 @@ func FuzzSimpleExecution(f *testing.F) {
 		}
 	})
 }
+
+func TestErrorRawLine(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.html":    {Data: []byte("first line\n{% include \"include.html\" %}\nlast line")},
+		"include.html": {Data: []byte("include\n\n{{ 1 / zero }}\n")},
+		"ssi.html":     {Data: []byte("{% ssi \"include.html\" %}")},
+	}
+	set := pongo2.NewSet("raw line", pongo2.NewFSLoader(fsys))
+
+	tests := []struct {
+		name string
+		tpl  func() (*pongo2.Template, error)
+		line string
+	}{
+		{
+			name: "include",
+			tpl:  func() (*pongo2.Template, error) { return set.FromFile("base.html") },
+			line: "{{ 1 / zero }}",
+		},
+		{
+			name: "string",
+			tpl:  func() (*pongo2.Template, error) { return set.FromString("hello\n{{ 1 / zero }} world") },
+			line: "{{ 1 / zero }} world",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpl, err := tt.tpl()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tpl.Execute(pongo2.Context{"zero": 0})
+			var perr *pongo2.Error
+			if !errors.As(err, &perr) {
+				t.Fatalf("Expected a *pongo2.Error, got: %v", err)
+			}
+			line, available, err := perr.RawLine()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !available || line != tt.line {
+				t.Fatalf("Expected raw line '%s', got '%s' (available: %t)", tt.line, line, available)
+			}
+		})
+	}
+
+	// Lexer errors carry the template as well
+	_, err := set.FromString("ok\n{{ \"unclosed }}")
+	var perr *pongo2.Error
+	if !errors.As(err, &perr) {
+		t.Fatalf("Expected a *pongo2.Error, got: %v", err)
+	}
+	if line, available, _ := perr.RawLine(); !available || line != "{{ \"unclosed }}" {
+		t.Fatalf("Expected raw line of the lexer error, got '%s' (available: %t)", line, available)
+	}
+
+	// ssi reads plaintext files through the loaders
+	out, err := set.RenderTemplateFile("ssi.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "include\n\n{{ 1 / zero }}\n" {
+		t.Fatalf("Unexpected ssi output: '%s'", out)
+	}
+}
+
+type structTagBase struct {
+	ID int `pongo2:"id"`
+}
+
+type structTagUser struct {
+	structTagBase
+	FirstName string `pongo2:"first_name" json:"firstName"`
+	LastName  string `json:"last_name,omitempty"`
+	Password  string `pongo2:"-"`
+}
+
+func TestStructTags(t *testing.T) {
+	user := &structTagUser{
+		structTagBase: structTagBase{ID: 42},
+		FirstName:     "Florian",
+		LastName:      "Schlachter",
+		Password:      "secret",
+	}
+
+	tests := []struct {
+		tpl          string
+		out          string
+		jsonFallback bool
+	}{
+		{"{{ user.first_name }}", "Florian", false},
+		{`{{ user["first_name"] }}`, "Florian", false},
+		{"{{ user.FirstName }}", "Florian", false},
+		{"{{ user.id }}", "42", false},
+		{"{{ user.Password }}", "", false},
+		{"{{ user.last_name }}", "", false},
+		{"{{ user.last_name }}", "Schlachter", true},
+		{`{{ user["last_name"] }}`, "Schlachter", true},
+		{"{{ user.firstName }}", "Florian", true},
+	}
+
+	for _, test := range tests {
+		set := pongo2.NewSet("struct tags", pongo2.MustNewLocalFileSystemLoader(""))
+		set.Options.JSONTagFallback = test.jsonFallback
+
+		tpl, err := set.FromString(test.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(pongo2.Context{"user": user})
+		if err != nil {
+			t.Fatalf("%s: %v", test.tpl, err)
+		}
+		if out != test.out {
+			t.Fatalf("%s (json fallback: %t): expected %q, got %q", test.tpl, test.jsonFallback, test.out, out)
+		}
+	}
+}
+
+type structTagA struct {
+	Code string `pongo2:"code"`
+	Name string `pongo2:"name"`
+}
+
+type structTagB struct {
+	Code string `pongo2:"code"`
+}
+
+type structTagDuplicates struct {
+	structTagA
+	structTagB
+	Title    string `pongo2:"name"`
+	Label    string `pongo2:"label"`
+	AltLabel string `pongo2:"label"`
+}
+
+func TestStructTagsDuplicates(t *testing.T) {
+	value := &structTagDuplicates{
+		structTagA: structTagA{Code: "a", Name: "embedded"},
+		structTagB: structTagB{Code: "b"},
+		Title:      "title",
+		Label:      "label",
+		AltLabel:   "alt",
+	}
+
+	// The least nested field wins, names used at the same depth are ambiguous
+	tests := map[string]string{
+		"{{ v.name }}":  "title",
+		"{{ v.code }}":  "",
+		"{{ v.label }}": "",
+		"{{ v.Label }}": "label",
+	}
+	for tc, expected := range tests {
+		out, err := pongo2.RenderTemplateString(tc, pongo2.Context{"v": value})
+		if err != nil {
+			t.Fatalf("%s: %v", tc, err)
+		}
+		if out != expected {
+			t.Errorf("%s: expected %q, got %q", tc, expected, out)
+		}
+	}
+}
+
+func TestRegisterTest(t *testing.T) {
+	if err := pongo2.RegisterTest("even", func(in *pongo2.Value, param *pongo2.Value) (bool, *pongo2.Error) {
+		return false, nil
+	}); err == nil {
+		t.Fatal("Expected an error when registering an existing test")
+	}
+
+	set := pongo2.NewSet("custom tests", pongo2.MustNewLocalFileSystemLoader(""))
+	if err := set.RegisterTest("prefixed", func(in *pongo2.Value, param *pongo2.Value) (bool, *pongo2.Error) {
+		return strings.HasPrefix(in.String(), param.String()), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if pongo2.TestExists("prefixed") {
+		t.Fatal("Per-set test leaked into the global registry")
+	}
+
+	tpl, err := set.FromString(`{{ "pongo2" is prefixed "pon" }} {{ "pongo2" is not prefixed("go") }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "True True" {
+		t.Fatalf("Unexpected output: %q", out)
+	}
+
+	if _, err := pongo2.FromString(`{{ "pongo2" is prefixed "pon" }}`); err == nil {
+		t.Fatal("Expected an error for a test registered in another set")
+	}
+}
+
+func TestUndefinedPolicy(t *testing.T) {
+	ctx := pongo2.Context{
+		"user": map[string]any{"name": "flosch", "nothing": nil},
+		"list": []int{1, 2},
+	}
+
+	set := pongo2.NewSet("undefined policy", pongo2.MustNewLocalFileSystemLoader(""))
+	set.Options.Undefined = pongo2.UndefinedError
+
+	valid := map[string]string{
+		"{{ user.name }}":                                   "flosch",
+		"{{ user.nothing }}":                                "",
+		`{{ usr|default:"guest" }}`:                         "guest",
+		`{{ user.nmae|default:"unknown" }}`:                 "unknown",
+		`{{ list.5|default_if_none:"none" }}`:               "none",
+		"{% if usr is defined %}yes{% else %}no{% endif %}": "no",
+		"{{ user.nmae is undefined }}":                      "True",
+		`{{ usr.name|default:"guest" }}`:                    "guest",
+	}
+	for tc, expected := range valid {
+		tpl, err := set.FromString(tc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", tc, err)
+		}
+		if out != expected {
+			t.Fatalf("%s: expected %q, got %q", tc, expected, out)
+		}
+	}
+
+	invalid := map[string]string{
+		"{{ usr }}":                        "'usr'",
+		"line\n{{ user.nmae|upper }}":      "'user.nmae'",
+		"{% if list.5 %}{% endif %}":       "'list.5'",
+		"{% for x in items %}{% endfor %}": "'items'",
+	}
+	for tc, name := range invalid {
+		tpl, err := set.FromString(tc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tpl.Execute(ctx)
+		if !errors.Is(err, pongo2.ErrUndefinedVariable) {
+			t.Fatalf("%s: expected ErrUndefinedVariable, got: %v", tc, err)
+		}
+		if !strings.Contains(err.Error(), name) {
+			t.Fatalf("%s: error doesn't name the variable: %v", tc, err)
+		}
+		var perr *pongo2.Error
+		if !errors.As(err, &perr) || perr.Line == 0 || perr.Column == 0 {
+			t.Fatalf("%s: expected an *Error with location, got: %#v", tc, err)
+		}
+	}
+
+	// The per-template option overrides the set's option
+	tpl, err := set.FromString("{{ usr }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.Options.Undefined = pongo2.UndefinedSilent
+	if out, err := tpl.Execute(ctx); err != nil || out != "" {
+		t.Fatalf("Expected silent undefined variable, got %q (%v)", out, err)
+	}
+}
+
+type countingLoader struct {
+	pongo2.TemplateLoader
+	gets map[string]int
+}
+
+func (l *countingLoader) Get(path string) (io.Reader, error) {
+	l.gets[path]++
+	return l.TemplateLoader.Get(path)
+}
+
+func TestImportCache(t *testing.T) {
+	fsys := fstest.MapFS{
+		"forms.html": {Data: []byte(`{% macro input(name, type="text") export %}<input type="{{ type }}" name="{{ name }}">{% endmacro %}`)},
+		"a.html":     {Data: []byte(`{% import "forms.html" as forms %}{{ forms.input("a") }}`)},
+		"b.html":     {Data: []byte(`{% from "forms.html" import * %}{{ input("b", type="password") }}`)},
+	}
+	loader := &countingLoader{TemplateLoader: pongo2.NewFSLoader(fsys), gets: make(map[string]int)}
+	set := pongo2.NewSet("import cache", loader)
+
+	for name, expected := range map[string]string{
+		"a.html": `<input type="text" name="a">`,
+		"b.html": `<input type="password" name="b">`,
+	} {
+		out, err := set.RenderTemplateFile(name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != expected {
+			t.Fatalf("%s: expected %q, got %q", name, expected, out)
+		}
+	}
+	if loader.gets["forms.html"] != 1 {
+		t.Fatalf("Expected forms.html to be loaded once, got %d loads", loader.gets["forms.html"])
+	}
+
+	// Cleaning the cache compiles the imported template again
+	set.CleanCache()
+	if _, err := set.FromFile("a.html"); err != nil {
+		t.Fatal(err)
+	}
+	if loader.gets["forms.html"] != 2 {
+		t.Fatalf("Expected forms.html to be loaded again, got %d loads", loader.gets["forms.html"])
+	}
+}
+
+func TestDynamicExtends(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.html":   {Data: []byte(`base[{% block content %}base{% endblock %}]`)},
+		"admin.html":  {Data: []byte(`admin[{% block content %}admin{% endblock %}]`)},
+		"middle.html": {Data: []byte(`{% extends layout %}{% block content %}middle>{{ block.Super }}{% endblock %}`)},
+		"page.html":   {Data: []byte(`{% extends layout %}{% block content %}page{% endblock %}`)},
+		"other.html":  {Data: []byte(`{% extends layout %}{% block content %}other{% endblock %}`)},
+		"loop.html":   {Data: []byte(`{% extends "loop.html" if loop else "base.html" %}`)},
+	}
+	set := pongo2.NewSet("dynamic extends", pongo2.NewFSLoader(fsys))
+
+	page, err := set.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := set.FromFile("other.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both children share the (cached) parents; rendering one mustn't affect the other
+	tests := []struct {
+		tpl      *pongo2.Template
+		layout   any
+		expected string
+	}{
+		{page, "base.html", "base[page]"},
+		{other, "base.html", "base[other]"},
+		{page, "admin.html", "admin[page]"},
+		{other, []string{"missing.html", "admin.html"}, "admin[other]"},
+		{page, "base.html", "base[page]"},
+	}
+	for _, tt := range tests {
+		out, err := tt.tpl.Execute(pongo2.Context{"layout": tt.layout})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tt.expected {
+			t.Fatalf("layout %v: expected %q, got %q", tt.layout, tt.expected, out)
+		}
+	}
+
+	// A template can be passed directly
+	middle, err := set.FromFile("middle.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := set.FromFile("base.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := middle.Execute(pongo2.Context{"layout": base})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "base[middle>base]" {
+		t.Fatalf("Unexpected output: %q", out)
+	}
+
+	// Circular inheritance is detected
+	loop, err := set.FromFile("loop.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loop.Execute(pongo2.Context{"loop": true}); err == nil || !strings.Contains(err.Error(), "circular inheritance") {
+		t.Fatalf("Expected a circular inheritance error, got: %v", err)
+	}
+}
+
+func TestDynamicExtendsFallbackCached(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.html": {Data: []byte(`base[{% block content %}{% endblock %}]`)},
+		"page.html": {Data: []byte(`{% extends ["missing.html", "base.html", "other.html"] %}{% block content %}page{% endblock %}`)},
+	}
+	loader := &countingFSLoader{FSLoader: pongo2.NewFSLoader(fsys), gets: make(map[string]int)}
+	set := pongo2.NewSet("dynamic extends fallback", loader)
+
+	tpl, err := set.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "base[page]" {
+			t.Fatalf("Expected 'base[page]', got %q", out)
+		}
+	}
+
+	// The fallback candidates are checked without reading them
+	if loader.gets["base.html"] != 1 || loader.gets["missing.html"] != 0 {
+		t.Fatalf("Expected base.html to be read once only, got: %v", loader.gets)
+	}
+}
+
+func TestConcurrentExecution(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.html": {Data: []byte("{% block title %}base{% endblock %}\n" +
+			"{% for i in items %}{% cycle \"a\" \"b\" %}{% ifchanged i %}{{ i }}{% endifchanged %}{% endfor %}\n" +
+			"{% block content %}{% endblock %}")},
+		"static.html":  {Data: []byte("{% extends \"base.html\" %}{% block title %}static{% endblock %}{% block content %}{{ block.Super }}s{% endblock %}")},
+		"dynamic.html": {Data: []byte("{% extends layout %}{% block title %}dynamic{% endblock %}{% block content %}d{% endblock %}")},
+		"trim.html":    {Data: []byte("{% if true %}\n    {{ user.Name }}\n  {% endif %}\n")},
+	}
+	set := pongo2.NewSet("concurrent", pongo2.NewFSLoader(fsys))
+	set.Options.TrimBlocks = true
+	set.Options.LStripBlocks = true
+
+	ctx := pongo2.Context{
+		"items":  []int{1, 1, 2, 3, 3},
+		"layout": "base.html",
+		"user":   struct{ Name string }{Name: "trimmed"},
+	}
+	expected := map[string]string{
+		"base.html":    "basea1ba2b3a",
+		"static.html":  "statica1ba2b3as",
+		"dynamic.html": "dynamica1ba2b3ad",
+		"trim.html":    "    trimmed\n",
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(expected)*8)
+	for i := 0; i < 8; i++ {
+		for name, out := range expected {
+			wg.Add(1)
+			go func(name, expectedOut string) {
+				defer wg.Done()
+				tpl, err := set.FromCache(name)
+				if err != nil {
+					errs <- err
+					return
+				}
+				for j := 0; j < 20; j++ {
+					out, err := tpl.Execute(ctx)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if out != expectedOut {
+						errs <- fmt.Errorf("%s: expected %q, got %q", name, expectedOut, out)
+						return
+					}
+				}
+			}(name, out)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+type countingFSLoader struct {
+	*pongo2.FSLoader
+	gets map[string]int
+}
+
+func (l *countingFSLoader) Get(path string) (io.Reader, error) {
+	l.gets[path]++
+	return l.FSLoader.Get(path)
+}
+
+func TestAutoReload(t *testing.T) {
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"base.html":  {Data: []byte(`[{% block content %}{% endblock %}]`), ModTime: modTime},
+		"part.html":  {Data: []byte(`part v1`), ModTime: modTime},
+		"page.html":  {Data: []byte(`{% extends "base.html" %}{% block content %}{% include "part.html" %}{% endblock %}`), ModTime: modTime},
+		"other.html": {Data: []byte(`{% extends "base.html" %}{% block content %}other{% endblock %}`), ModTime: modTime},
+		"text.txt":   {Data: []byte(`text v1`), ModTime: modTime},
+		"ssi.html":   {Data: []byte(`{% ssi "text.txt" %}`), ModTime: modTime},
+	}
+	loader := &countingFSLoader{FSLoader: pongo2.NewFSLoader(fsys), gets: make(map[string]int)}
+	set := pongo2.NewSet("auto reload", loader)
+	set.AutoReload = true
+
+	render := func(name, expected string) *pongo2.Template {
+		t.Helper()
+		tpl, err := set.FromCache(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != expected {
+			t.Fatalf("%s: expected %q, got %q", name, expected, out)
+		}
+		return tpl
+	}
+
+	page := render("page.html", "[part v1]")
+	other := render("other.html", "[other]")
+	render("ssi.html", "text v1")
+
+	// Unchanged templates are neither read nor recompiled
+	if render("page.html", "[part v1]") != page {
+		t.Fatal("Expected the cached page.html")
+	}
+	if loader.gets["page.html"] != 1 || loader.gets["base.html"] != 1 || loader.gets["part.html"] != 1 {
+		t.Fatalf("Expected each template to be read once, got: %v", loader.gets)
+	}
+
+	// Only the changed template and its dependents are recompiled
+	fsys["part.html"] = &fstest.MapFile{Data: []byte(`part v2`), ModTime: modTime.Add(time.Second)}
+	if render("page.html", "[part v2]") == page {
+		t.Fatal("Expected page.html to be recompiled")
+	}
+	if render("other.html", "[other]") != other {
+		t.Fatal("Expected the cached other.html")
+	}
+	if loader.gets["base.html"] != 1 || loader.gets["other.html"] != 1 || loader.gets["page.html"] != 2 {
+		t.Fatalf("Expected only part.html and page.html to be read again, got: %v", loader.gets)
+	}
+
+	// A new modification time without changes doesn't recompile anything
+	fsys["base.html"].ModTime = modTime.Add(time.Minute)
+	if render("other.html", "[other]") != other {
+		t.Fatal("Expected the cached other.html")
+	}
+	reads := loader.gets["base.html"]
+	render("other.html", "[other]")
+	if loader.gets["base.html"] != reads {
+		t.Fatalf("Expected the new modification time to be recorded, base.html was read again: %v", loader.gets)
+	}
+
+	// Plaintext files included by ssi are tracked as well
+	fsys["text.txt"] = &fstest.MapFile{Data: []byte(`text v2`), ModTime: modTime.Add(time.Second)}
+	render("ssi.html", "text v2")
+
+	// CleanCache removes the dependents of a template
+	set.AutoReload = false
+	fsys["base.html"] = &fstest.MapFile{Data: []byte(`<{% block content %}{% endblock %}>`), ModTime: modTime.Add(time.Hour)}
+	render("other.html", "[other]")
+	set.CleanCache("base.html")
+	render("other.html", "<other>")
+}
+
+func TestFromFileRecompilesReferences(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.html": {Data: []byte(`base v1 {% block content %}{% endblock %}`)},
+		"inc.html":  {Data: []byte(`inc v1`)},
+		"ssi.html":  {Data: []byte(`ssi v1`)},
+		"main.html": {Data: []byte(`{% extends "base.html" %}{% block content %}[{% include "inc.html" %}] [{% ssi "ssi.html" parsed %}]{% endblock %}`)},
+	}
+	set := pongo2.NewSet("references", pongo2.NewFSLoader(fsys))
+
+	render := func(expected string) {
+		t.Helper()
+		tpl, err := set.FromFile("main.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != expected {
+			t.Fatalf("Expected %q, got %q", expected, out)
+		}
+	}
+
+	render("base v1 [inc v1] [ssi v1]")
+
+	// Without AutoReload, FromFile compiles the referenced templates again
+	fsys["base.html"] = &fstest.MapFile{Data: []byte(`base v2 {% block content %}{% endblock %}`)}
+	fsys["inc.html"] = &fstest.MapFile{Data: []byte(`inc v2`)}
+	fsys["ssi.html"] = &fstest.MapFile{Data: []byte(`ssi v2`)}
+	render("base v2 [inc v2] [ssi v2]")
+}
+
+func TestLocalFilesystemLoaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "watched.html")
+	if err := os.WriteFile(filename, []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loader, err := pongo2.NewLocalFileSystemLoader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan string, 10)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- loader.Watch(ctx, 10*time.Millisecond, func(path string) {
+			changes <- path
+		})
+	}()
+
+	// The first scan of the watcher only records the initial state; the file is
+	// modified (with a new modification time) until the watcher reports a change.
+	timeout := time.After(5 * time.Second)
+	for i := 1; ; i++ {
+		modTime := time.Now().Add(time.Duration(i) * time.Hour)
+		if err := os.WriteFile(filename, []byte(fmt.Sprintf("v%d", i+1)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filename, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case path := <-changes:
+			if path != filename {
+				t.Fatalf("Expected a change of %s, got %s", filename, path)
+			}
+		case <-time.After(50 * time.Millisecond):
+			continue
+		case <-timeout:
+			t.Fatal("The change hasn't been detected")
+		}
+		break
+	}
+
+	cancel()
+	if err := <-watchErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestContextualAutoescape(t *testing.T) {
+	ctx := pongo2.Context{
+		"text":  `<b>"Tom" & 'Jerry'</b>`,
+		"url":   "javascript:alert(1)",
+		"page":  "/docs/a b",
+		"query": "a&b=c d",
+		"num":   42,
+		"data":  map[string]any{"name": "</script>"},
+		"color": "red;background:url(x)",
+		"attr":  "x onload=alert(1)",
+		"html":  pongo2.AsSafeValue("<i>ok</i>"),
+	}
+
+	set := pongo2.NewSet("contextual autoescape", pongo2.MustNewLocalFileSystemLoader(""))
+	set.Options.AutoescapeMode = pongo2.AutoescapeContextual
+
+	tests := map[string]string{
+		`<p>{{ text }}</p>`:                                           `<p>&lt;b&gt;&quot;Tom&quot; &amp; &#39;Jerry&#39;&lt;/b&gt;</p>`,
+		`<a title="{{ text }}">`:                                      `<a title="&lt;b&gt;&quot;Tom&quot; &amp; &#39;Jerry&#39;&lt;/b&gt;">`,
+		`<a title={{ attr }}>`:                                        `<a title=x&#32;onload&#61;alert(1)>`,
+		`<a href="{{ url }}">`:                                        `<a href="#ZgotmplZ">`,
+		`<a href="{{ page }}?q={{ query }}">`:                         `<a href="/docs/a%20b?q=a%26b%3Dc%20d">`,
+		`<a href="https://example.com/{{ query }}">`:                  `<a href="https://example.com/a&amp;b=c%20d">`,
+		`<script>var s = "{{ text }}";</script>`:                      `<script>var s = "\x3cb\x3e\x22Tom\x22 \x26 \x27Jerry\x27\x3c\/b\x3e";</script>`,
+		`<script>var n = {{ num }}, t = {{ page }};`:                  `<script>var n = 42, t = "\/docs\/a b";`,
+		`<script>var d = {{ data }};</script>`:                        `<script>var d =  {"name":"\u003c/script\u003e"} ;</script>`,
+		`<script>// it's {{ num }}` + "\n" + `'{{ page }}'`:           `<script>// it's 42` + "\n" + `'\/docs\/a b'`,
+		`<button onclick="f('{{ text }}')">`:                          `<button onclick="f('\x3cb\x3e\x22Tom\x22 \x26 \x27Jerry\x27\x3c\/b\x3e')">`,
+		`<p style="color: {{ color }}">`:                              `<p style="color: red\3b background\3aurl\28x\29">`,
+		`<style>p { color: {{ color }} }</style>`:                     `<style>p { color: red\3b background\3aurl\28x\29 }</style>`,
+		`<script></script><p>{{ text }}</p>`:                          `<script></script><p>&lt;b&gt;&quot;Tom&quot; &amp; &#39;Jerry&#39;&lt;/b&gt;</p>`,
+		`<p>{{ html }}</p><script>{{ num|safe }}`:                     `<p><i>ok</i></p><script>42`,
+		`{% autoescape off %}<a href="{{ url }}">{% endautoescape %}`: `<a href="javascript:alert(1)">`,
+		`<a href="{% firstof missing url %}">`:                        `<a href="#ZgotmplZ">`,
+		`<a href="{% firstof page %}?q={{ query }}">`:                 `<a href="/docs/a%20b?q=a%26b%3Dc%20d">`,
+		`<script>{% macro m() %}{% endmacro %}{% call m() %}</script><p>{% endcall %}var s = {{ page }};</script>`: `<script>var s = "\/docs\/a b";</script>`,
+	}
+	for tc, expected := range tests {
+		tpl, err := set.FromString(tc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", tc, err)
+		}
+		if out != expected {
+			t.Errorf("%s: expected %q, got %q", tc, expected, out)
+		}
+	}
+
+	// The default mode escapes HTML special characters only
+	tpl, err := pongo2.FromString(`<a href="{{ url }}">{{ text }}</a>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `<a href="javascript:alert(1)">&lt;b&gt;&quot;Tom&quot; &amp; &#39;Jerry&#39;&lt;/b&gt;</a>`; out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestContextualAutoescapeBlocks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.html":    {Data: []byte(`<script>var x = {% block js %}{% endblock %};</script><p>{% block content %}{% endblock %}</p>`)},
+		"child.html":   {Data: []byte(`{% extends "base.html" %}{% block js %}{{ data }}{% endblock %}{% block content %}{{ data }}{% endblock %}`)},
+		"middle.html":  {Data: []byte(`{% extends "base.html" %}{% block content %}-{% endblock %}`)},
+		"leaf.html":    {Data: []byte(`{% extends "middle.html" %}{% block js %}[{{ data }}]{% endblock %}`)},
+		"dynamic.html": {Data: []byte(`{% extends layout %}{% block content %}<i>{{ data }}</i>{% endblock %}`)},
+		"dynamic.js":   {Data: []byte(`{% extends layout %}{% block js %}{{ data }}{% endblock %}`)},
+	}
+	ctx := pongo2.Context{"data": `1; alert("x")`, "layout": "base.html"}
+
+	set := pongo2.NewSet("contextual blocks", pongo2.NewFSLoader(fsys))
+	set.Options.AutoescapeMode = pongo2.AutoescapeContextual
+
+	// Blocks overriding a block of a static parent are escaped for the parent's context
+	tests := map[string]string{
+		"child.html":   `<script>var x = "1; alert(\x22x\x22)";</script><p>1; alert(&quot;x&quot;)</p>`,
+		"leaf.html":    `<script>var x = ["1; alert(\x22x\x22)"];</script><p>-</p>`,
+		"dynamic.html": `<script>var x = ;</script><p><i>1; alert(&quot;x&quot;)</i></p>`,
+	}
+	for name, expected := range tests {
+		out, err := set.RenderTemplateFile(name, ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, out)
+		}
+	}
+
+	// The context of a block of a dynamic parent is unknown at compile time
+	_, err := set.RenderTemplateFile("dynamic.js", ctx)
+	if err == nil || !strings.Contains(err.Error(), "different HTML context") {
+		t.Errorf("expected an error about the HTML context of the block, got %v", err)
+	}
+}
+
+func TestEscapers(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.html":  {Data: []byte(`{{ value }}`)},
+		"report.tex": {Data: []byte(`{{ value }} {% include "page.html" %}`)},
+		"mail.txt":   {Data: []byte(`{{ value }}`)},
+		"data.csv":   {Data: []byte(`{{ value }},{% autoescape html %}{{ value }}{% endautoescape %}`)},
+		"other.tpl":  {Data: []byte(`{{ value }}`)},
+		"feed.xml":   {Data: []byte(`<title>{{ value }}</title>`)},
+		"run.sh":     {Data: []byte(`echo {{ value }} {{ quote }}`)},
+	}
+	ctx := pongo2.Context{"value": `<a> & "b", 50%`, "quote": "it's"}
+
+	set := pongo2.NewSet("escapers", pongo2.NewFSLoader(fsys))
+	set.EscaperByExtension = true
+	err := set.RegisterEscaper("csv", pongo2.EscaperFunc(func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}), ".csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := set.RegisterEscaper("html", pongo2.EscaperFunc(strings.ToUpper)); err == nil {
+		t.Fatal("expected an error when registering an existing escaper")
+	}
+
+	tests := map[string]string{
+		"page.html":  `&lt;a&gt; &amp; &quot;b&quot;, 50%`,
+		"report.tex": `<a> \& "b", 50\% &lt;a&gt; &amp; &quot;b&quot;, 50%`, // included templates use their own escaper
+		"mail.txt":   `<a> & "b", 50%`,
+		"data.csv":   `"<a> & ""b"", 50%",&lt;a&gt; &amp; &quot;b&quot;, 50%`,
+		"other.tpl":  `&lt;a&gt; &amp; &quot;b&quot;, 50%`,
+		"feed.xml":   `<title>&lt;a&gt; &amp; &quot;b&quot;, 50%</title>`,
+		"run.sh":     `echo '<a> & "b", 50%' 'it'\''s'`,
+	}
+	for name, expected := range tests {
+		out, err := set.RenderTemplateFile(name, ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, out)
+		}
+	}
+
+	// An escaper of the set is used for all its templates
+	set = pongo2.NewSet("set escaper", pongo2.NewFSLoader(fsys))
+	set.Escaper = pongo2.EscaperFunc(strings.ToUpper)
+	set.EscaperByExtension = true
+	out, err := set.RenderTemplateFile("page.html", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `<A> & "B", 50%`; out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+
+	// Without EscaperByExtension, all templates use HTML escaping
+	set = pongo2.NewSet("html escaper", pongo2.NewFSLoader(fsys))
+	for _, name := range []string{"run.sh", "mail.txt"} {
+		out, err = set.RenderTemplateFile(name, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, `&lt;a&gt; &amp; &quot;b&quot;, 50%`) {
+			t.Errorf("%s: expected HTML escaping, got %q", name, out)
+		}
+	}
+}
+
+func TestAutoescapeOptions(t *testing.T) {
+	ctx := pongo2.Context{"value": "<b>"}
+	render := func(set *pongo2.TemplateSet) string {
+		tpl, err := set.FromString("{{ value }}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	escaping := pongo2.NewSet("escaping", pongo2.MustNewLocalFileSystemLoader(""))
+	raw := pongo2.NewSet("raw", pongo2.MustNewLocalFileSystemLoader(""))
+	raw.Options.DisableAutoescape = true
+
+	// Sets don't influence each other, even if they're used concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if out := render(escaping); out != "&lt;b&gt;" {
+				t.Errorf("escaping set: got %q", out)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if out := render(raw); out != "<b>" {
+				t.Errorf("raw set: got %q", out)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// A template's options can override the set's
+	tpl, err := raw.FromString("{{ value }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.Options.DisableAutoescape = false
+	if out, err := tpl.Execute(ctx); err != nil || out != "&lt;b&gt;" {
+		t.Errorf("expected the template to escape, got %q (%v)", out, err)
+	}
+
+	// The deprecated SetAutoescape only changes the DefaultSet
+	pongo2.SetAutoescape(false)
+	defer pongo2.SetAutoescape(true)
+	if out := render(pongo2.DefaultSet); out != "<b>" {
+		t.Errorf("default set: got %q", out)
+	}
+	if out := render(escaping); out != "&lt;b&gt;" {
+		t.Errorf("escaping set: got %q", out)
+	}
+}
+
+func TestSetAutoescapeConcurrent(t *testing.T) {
+	// Run with -race: the deprecated SetAutoescape may be called while templates are created
+	defer pongo2.SetAutoescape(true)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			pongo2.SetAutoescape(i%2 == 0)
+		}(i)
+		go func() {
+			defer wg.Done()
+			tpl, err := pongo2.FromString("{{ value }}")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if out, err := tpl.Execute(pongo2.Context{"value": "<b>"}); err != nil || (out != "<b>" && out != "&lt;b&gt;") {
+				t.Errorf("unexpected output %q (%v)", out, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+type sanitizedFragment string
+
+func (f sanitizedFragment) SafeString() string {
+	return string(f)
+}
+
+func TestSafeTypes(t *testing.T) {
+	ctx := pongo2.Context{
+		"html":     template.HTML("<b>bold</b>"),
+		"attr":     template.HTMLAttr(`data-x="1"`),
+		"url":      template.URL("javascript:void(0)"),
+		"js":       template.JS("alert(1)"),
+		"jsstr":    template.JSStr(`it\'s`),
+		"css":      template.CSS("color: red"),
+		"fragment": sanitizedFragment("<i>ok</i>"),
+		"text":     "<b>",
+		"xss":      template.URL("https://x/?q=<script>alert(1)</script>"),
+	}
+
+	tests := map[string]string{
+		"{{ html }} {{ fragment }} {{ text }}": "<b>bold</b> <i>ok</i> &lt;b&gt;",
+		"{{ url }} {{ js }} {{ css }}":         "javascript:void(0) alert(1) color: red",
+		"<p>{{ xss }}</p>":                     "<p>https://x/?q=&lt;script&gt;alert(1)&lt;/script&gt;</p>", // only template.HTML is trusted
+		"{{ html|upper }}":                     "&lt;B&gt;BOLD&lt;/B&gt;",                                   // filters return plain strings
+		"{{ fragment|safe }}":                  "<i>ok</i>",
+
+		// the types are strings otherwise
+		"{% if html %}yes{% else %}no{% endif %} {% if not fragment %}no{% endif %}": "yes ",
+		"{{ html|length }} {{ fragment|length }} {{ html|first }}":                   "11 9 &lt;",
+		`{{ html|default:"d" }} {{ fragment|default:"d" }}`:                          "<b>bold</b> <i>ok</i>",
+		"{% firstof css text %} {% firstof url %}":                                   "color: red javascript:void(0)",
+		"{% firstof html %} {% firstof fragment %} {% firstof text %}":               "<b>bold</b> <i>ok</i> &lt;b&gt;",
+		`{{ html is string }} {{ "bold" in html }}`:                                  "True True",
+	}
+	for tc, expected := range tests {
+		out, err := pongo2.RenderTemplateString(tc, ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", tc, err)
+		}
+		if out != expected {
+			t.Errorf("%s: expected %q, got %q", tc, expected, out)
+		}
+	}
+
+	// With contextual autoescaping the types are only trusted within a matching context
+	set := pongo2.NewSet("safe types", pongo2.MustNewLocalFileSystemLoader(""))
+	set.Options.AutoescapeMode = pongo2.AutoescapeContextual
+	contextual := map[string]string{
+		`<p>{{ html }}</p><p title="{{ html }}">`:                 `<p><b>bold</b></p><p title="&lt;b&gt;bold&lt;/b&gt;">`,
+		`<a href="{{ url }}" {{ attr }}>{{ fragment }}</a>`:       `<a href="javascript:void%280%29" data-x="1"><i>ok</i></a>`,
+		`<a href="{{ text }}">`:                                   `<a href="%3Cb%3E">`,
+		`<script>{{ js }}; var s = '{{ jsstr }}', h = {{ html }}`: `<script>alert(1); var s = 'it\'s', h = "\x3cb\x3ebold\x3c\/b\x3e"`,
+		`<p style="{{ css }}" onclick="{{ js }}">`:                `<p style="color: red" onclick="alert(1)">`,
+	}
+	for tc, expected := range contextual {
+		tpl, err := set.FromString(tc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", tc, err)
+		}
+		if out != expected {
+			t.Errorf("%s: expected %q, got %q", tc, expected, out)
+		}
+	}
+
+	// Other escapers only trust SafeString
+	out, err := pongo2.RenderTemplateString("{% autoescape latex %}{{ html }} {{ fragment }}{% endautoescape %}",
+		pongo2.Context{"html": template.HTML("50%"), "fragment": sanitizedFragment("50\\%")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `50\% 50\%`; out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}
+
+// flushRecorder records the chunks written between two flushes.
+type flushRecorder struct {
+	pending strings.Builder
+	chunks  []string
+}
+
+func (r *flushRecorder) Write(p []byte) (int, error) {
+	return r.pending.Write(p)
+}
+
+func (r *flushRecorder) Flush() {
+	r.chunks = append(r.chunks, r.pending.String())
+	r.pending.Reset()
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestExecuteStream(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.html": {Data: []byte(`<html>{% block head %}<head>{% endblock %}{% block body %}{% endblock %}</html>`)},
+		"page.html": {Data: []byte(`{% extends "base.html" %}{% block body %}<p>{{ content() }}</p>{% endblock %}`)},
+	}
+	set := pongo2.NewSet("stream", pongo2.NewFSLoader(fsys))
+	tpl, err := set.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := pongo2.Context{"content": func() string { return "content" }}
+	failing := pongo2.Context{"content": func() (string, error) { return "", errors.New("backend down") }}
+
+	// Flush after each top-level block
+	w := &flushRecorder{}
+	if err := tpl.ExecuteStream(context.Background(), ok, w, pongo2.StreamOptions{FlushAfterBlocks: true}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"<html><head>", "<p>content</p>", "</html>"}; !reflect.DeepEqual(w.chunks, expected) {
+		t.Errorf("expected chunks %q, got %q", expected, w.chunks)
+	}
+
+	// Flush once enough output is buffered
+	w = &flushRecorder{}
+	if err := tpl.ExecuteStream(context.Background(), ok, w, pongo2.StreamOptions{FlushSize: 13}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"<html><head><p>content</p>", "</html>"}; !reflect.DeepEqual(w.chunks, expected) {
+		t.Errorf("expected chunks %q, got %q", expected, w.chunks)
+	}
+
+	// The output since the last checkpoint is replaced by the fallback fragment
+	w = &flushRecorder{}
+	var hookErr error
+	err = tpl.ExecuteStream(context.Background(), failing, w, pongo2.StreamOptions{
+		FlushAfterBlocks: true,
+		OnError: func(w io.Writer, err error) {
+			hookErr = err
+			fmt.Fprint(w, "<p>Sorry.</p></html>")
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "backend down") {
+		t.Fatalf("expected the execution error, got: %v", err)
+	}
+	if hookErr != err {
+		t.Errorf("expected OnError to receive %v, got %v", err, hookErr)
+	}
+	if expected := []string{"<html><head>"}; !reflect.DeepEqual(w.chunks, expected) {
+		t.Errorf("expected chunks %q, got %q", expected, w.chunks)
+	}
+	if expected := "<p>Sorry.</p></html>"; w.pending.String() != expected {
+		t.Errorf("expected fallback %q, got %q", expected, w.pending.String())
+	}
+
+	// OnError isn't called if writing to w fails
+	hookErr = nil
+	err = tpl.ExecuteStream(context.Background(), ok, failingWriter{}, pongo2.StreamOptions{
+		FlushAfterBlocks: true,
+		OnError:          func(w io.Writer, err error) { hookErr = err },
+	})
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("expected the write error, got: %v", err)
+	}
+	if hookErr != nil {
+		t.Errorf("expected OnError not to be called, got %v", hookErr)
+	}
+
+	// Without checkpoints nothing is written on error
+	var buf strings.Builder
+	if err := set.ExecuteStream(context.Background(), "page.html", failing, &buf, pongo2.StreamOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if buf.Len() > 0 {
+		t.Errorf("expected no output, got %q", buf.String())
+	}
+}
@@ -0,0 +1,54 @@
+package pongo2
+
+import "html/template"
+
+// SafeString is implemented by types whose content is safe to be written into
+// a template without escaping (e. g. pre-sanitized fragments). The result of
+// SafeString is written as-is, regardless of autoescaping and the escaper used.
+type SafeString interface {
+	SafeString() string
+}
+
+// contentType is the type of pre-sanitized content provided by the types of
+// html/template (such as template.HTML).
+type contentType uint8
+
+const (
+	contentPlain    contentType = iota // not pre-sanitized
+	contentHTML                        // template.HTML
+	contentHTMLAttr                    // template.HTMLAttr
+	contentCSS                         // template.CSS
+	contentJS                          // template.JS
+	contentJSStr                       // template.JSStr
+	contentURL                         // template.URL and template.Srcset
+)
+
+// htmlContent returns the content of a value of one of html/template's safe types.
+// It returns contentPlain for all other values.
+func htmlContent(val any) (string, contentType) {
+	switch val := val.(type) {
+	case template.HTML:
+		return string(val), contentHTML
+	case template.HTMLAttr:
+		return string(val), contentHTMLAttr
+	case template.CSS:
+		return string(val), contentCSS
+	case template.JS:
+		return string(val), contentJS
+	case template.JSStr:
+		return string(val), contentJSStr
+	case template.URL:
+		return string(val), contentURL
+	case template.Srcset:
+		return string(val), contentURL
+	}
+	return "", contentPlain
+}
+
+// safeString returns the content of a value implementing SafeString.
+func safeString(val any) (string, bool) {
+	if s, ok := val.(SafeString); ok {
+		return s.SafeString(), true
+	}
+	return "", false
+}
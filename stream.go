@@ -0,0 +1,97 @@
+package pongo2
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+)
+
+// StreamOptions define when ExecuteStream writes the output generated so far to
+// its writer (checkpoints) and how errors are handled. With the zero value the
+// output is written at the end of the execution only (like ExecuteWriter).
+type StreamOptions struct {
+	// FlushAfterBlocks writes the output after each top-level block
+	// ({% block %}) of the root template of the inheritance chain.
+	FlushAfterBlocks bool
+
+	// FlushSize writes the output after a top-level node of the root
+	// template once at least FlushSize bytes are buffered (0 disables it).
+	// The size is only checked between top-level nodes, so the output of a
+	// large loop or block of the root template is written at once.
+	FlushSize int
+
+	// OnError is called if the execution fails (but not if writing to w
+	// fails). The output generated since
+	// the last checkpoint is discarded; OnError can write a fallback fragment
+	// (e. g. an error message and closing tags) to w, which already received
+	// the output up to the last checkpoint. The error is returned by
+	// ExecuteStream nevertheless.
+	OnError func(w io.Writer, err error)
+}
+
+// streamWriter buffers the output between two checkpoints of ExecuteStream.
+type streamWriter struct {
+	w        io.Writer
+	buf      bytes.Buffer
+	opts     StreamOptions
+	writeErr error // error writing to w at a checkpoint
+}
+
+// checkpoint is called after each top-level node of the root template.
+func (sw *streamWriter) checkpoint(ctx *ExecutionContext, node INode) *Error {
+	_, isBlock := node.(*tagBlockNode)
+	if (sw.opts.FlushAfterBlocks && isBlock) || (sw.opts.FlushSize > 0 && sw.buf.Len() >= sw.opts.FlushSize) {
+		if err := sw.flush(); err != nil {
+			sw.writeErr = err
+			return ctx.OrigError(err, nil)
+		}
+	}
+	return nil
+}
+
+// flush writes the buffered output to w and flushes w if it's an http.Flusher
+// (such as an http.ResponseWriter).
+func (sw *streamWriter) flush() error {
+	if sw.buf.Len() > 0 {
+		if _, err := sw.buf.WriteTo(sw.w); err != nil {
+			return err
+		}
+	}
+	if flusher, ok := sw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// ExecuteStream executes the template and writes the output to w at the
+// checkpoints defined by opts, so (large) pages can be sent to the client
+// before the execution has finished. If w is an http.Flusher (such as an
+// http.ResponseWriter), it's flushed at every checkpoint.
+//
+// Unlike ExecuteWriter, parts of the output might have been written if an
+// error occurs; opts.OnError allows to emit a fallback fragment in this case.
+func (tpl *Template) ExecuteStream(ctx context.Context, data Context, w io.Writer, opts StreamOptions) error {
+	sw := &streamWriter{w: w, opts: opts}
+	tw := getTemplateWriter(&sw.buf)
+	defer putTemplateWriter(tw)
+
+	if err := tpl.execute(ctx, data, tw, sw.checkpoint); err != nil {
+		// There's no point in writing a fallback fragment if w fails
+		if opts.OnError != nil && sw.writeErr == nil {
+			opts.OnError(w, err)
+		}
+		return err
+	}
+	return sw.flush()
+}
+
+// ExecuteStream is a shortcut and renders a template file (loaded through
+// FromCache) to w. See Template.ExecuteStream for more details.
+func (set *TemplateSet) ExecuteStream(ctx context.Context, filename string, data Context, w io.Writer, opts StreamOptions) error {
+	tpl, err := set.FromCache(filename)
+	if err != nil {
+		return err
+	}
+	return tpl.ExecuteStream(ctx, data, w, opts)
+}
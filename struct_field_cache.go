@@ -2,6 +2,7 @@ package pongo2
 
 import (
 	"reflect"
+	"strings"
 	"sync"
 )
 
@@ -9,10 +10,42 @@ import (
 type structFieldCache struct {
 	mu    sync.RWMutex
 	cache map[reflect.Type]map[string][]int // Type -> FieldName -> Field index path
+	tags  map[reflect.Type]*structTagNames  // Type -> names given by struct tags
+}
+
+// structTagNames maps the names given by `pongo2` and `json` struct tags to
+// the field index paths of a struct type. hidden contains the Go names of
+// fields tagged with `pongo2:"-"`.
+type structTagNames struct {
+	pongo2 map[string][]int
+	json   map[string][]int
+	hidden map[string]bool
 }
 
 var globalStructFieldCache = &structFieldCache{
 	cache: make(map[reflect.Type]map[string][]int),
+	tags:  make(map[reflect.Type]*structTagNames),
+}
+
+// getField returns the field index path for a name used in a template.
+// Names given by a `pongo2` struct tag take precedence over the Go field
+// names; `json` struct tag names are used as a fallback if jsonFallback is set.
+func (c *structFieldCache) getField(typ reflect.Type, name string, jsonFallback bool) ([]int, bool) {
+	tagNames := c.getTagNames(typ)
+	if indices, ok := tagNames.pongo2[name]; ok {
+		return indices, true
+	}
+	if !tagNames.hidden[name] {
+		if indices, ok := c.getFieldIndex(typ, name); ok {
+			return indices, true
+		}
+	}
+	if jsonFallback {
+		if indices, ok := tagNames.json[name]; ok {
+			return indices, true
+		}
+	}
+	return nil, false
 }
 
 // getFieldIndex returns the cached field index path or computes and caches it
@@ -42,3 +75,77 @@ func (c *structFieldCache) getFieldIndex(typ reflect.Type, fieldName string) ([]
 
 	return field.Index, true
 }
+
+// getTagNames returns the cached struct tag names of typ or computes and caches them
+func (c *structFieldCache) getTagNames(typ reflect.Type) *structTagNames {
+	c.mu.RLock()
+	tagNames, ok := c.tags[typ]
+	c.mu.RUnlock()
+	if ok {
+		return tagNames
+	}
+
+	tagNames = &structTagNames{
+		hidden: make(map[string]bool),
+	}
+	pongo2Fields := make(map[string][][]int)
+	jsonFields := make(map[string][][]int)
+	for _, field := range reflect.VisibleFields(typ) {
+		if !field.IsExported() {
+			continue
+		}
+		if name, ok := field.Tag.Lookup("pongo2"); ok {
+			if name == "-" {
+				tagNames.hidden[field.Name] = true
+				continue
+			}
+			addTagName(pongo2Fields, name, field.Index)
+		}
+		if name, ok := field.Tag.Lookup("json"); ok {
+			name, _, _ = strings.Cut(name, ",")
+			if name != "-" {
+				addTagName(jsonFields, name, field.Index)
+			}
+		}
+	}
+
+	tagNames.pongo2 = resolveTagNames(pongo2Fields)
+	tagNames.json = resolveTagNames(jsonFields)
+
+	c.mu.Lock()
+	c.tags[typ] = tagNames
+	c.mu.Unlock()
+
+	return tagNames
+}
+
+// addTagName collects the fields using a struct tag name.
+func addTagName(fields map[string][][]int, name string, index []int) {
+	if name == "" {
+		return
+	}
+	fields[name] = append(fields[name], index)
+}
+
+// resolveTagNames maps each struct tag name to its field. Like encoding/json,
+// the least nested field wins if a name is used more than once; a name used
+// by several fields at the same (least) depth is ambiguous and ignored.
+func resolveTagNames(fields map[string][][]int) map[string][]int {
+	names := make(map[string][]int, len(fields))
+	for name, indices := range fields {
+		var winner []int
+		ambiguous := false
+		for _, index := range indices {
+			switch {
+			case winner == nil || len(index) < len(winner):
+				winner, ambiguous = index, false
+			case len(index) == len(winner):
+				ambiguous = true
+			}
+		}
+		if !ambiguous {
+			names[name] = winner
+		}
+	}
+	return names
+}
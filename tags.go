@@ -93,14 +93,14 @@ func (p *Parser) parseTagElement() (INodeTag, *Error) {
 	}
 
 	// Check for the existing tag
-	tag, exists := tags[tokenName.Val]
+	tag, exists := p.template.set.getTag(tokenName.Val)
 	if !exists {
 		// Does not exists
 		return nil, p.Error(fmt.Sprintf("Tag '%s' not found (or beginning tag not provided)", tokenName.Val), tokenName)
 	}
 
 	// Check sandbox tag restriction
-	if _, isBanned := p.template.set.bannedTags[tokenName.Val]; isBanned {
+	if !p.template.set.tagAllowed(tokenName.Val) {
 		return nil, p.Error(fmt.Sprintf("Usage of tag '%s' is not allowed (sandbox restriction active).", tokenName.Val), tokenName)
 	}
 
@@ -119,6 +119,7 @@ func (p *Parser) parseTagElement() (INodeTag, *Error) {
 	p.Match(TokenSymbol, "%}")
 
 	argParser := newParser(p.name, argsToken, p.template)
+	argParser.macro = p.macro
 	if len(argsToken) == 0 {
 		// This is done to have nice EOF error messages
 		argParser.lastToken = tokenName
@@ -1,20 +1,26 @@
 package pongo2
 
+import "fmt"
+
 type tagAutoescapeNode struct {
 	wrapper    *NodeWrapper
 	autoescape bool
+	escaper    Escaper // nil for 'on' and 'off' (the current escaper is kept)
 }
 
 func (node *tagAutoescapeNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	old := ctx.Autoescape
+	old, oldEscaper := ctx.Autoescape, ctx.escaper
 	ctx.Autoescape = node.autoescape
+	if node.escaper != nil {
+		ctx.escaper = node.escaper
+	}
 
 	err := node.wrapper.Execute(ctx, writer)
 	if err != nil {
 		return err
 	}
 
-	ctx.Autoescape = old
+	ctx.Autoescape, ctx.escaper = old, oldEscaper
 
 	return nil
 }
@@ -32,12 +38,20 @@ func tagAutoescapeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag
 	if modeToken == nil {
 		return nil, arguments.Error("A mode is required for autoescape-tag.", nil)
 	}
-	if modeToken.Val == "on" {
+	switch modeToken.Val {
+	case "on":
 		autoescapeNode.autoescape = true
-	} else if modeToken.Val == "off" {
+	case "off":
 		autoescapeNode.autoescape = false
-	} else {
-		return nil, arguments.Error("Only 'on' or 'off' is valid as an autoescape-mode.", nil)
+	default:
+		// An escaping strategy, e. g. {% autoescape latex %}
+		escaper, found := doc.template.set.getEscaper(modeToken.Val)
+		if !found {
+			return nil, arguments.Error(fmt.Sprintf("Only 'on', 'off' or an escaper name is valid as an autoescape-mode (got '%s').",
+				modeToken.Val), modeToken)
+		}
+		autoescapeNode.autoescape = true
+		autoescapeNode.escaper = escaper
 	}
 
 	if arguments.Remaining() > 0 {
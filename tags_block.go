@@ -5,22 +5,37 @@ import (
 )
 
 type tagBlockNode struct {
-	name string
+	position      *Token
+	name          string
+	escapeContext escapeContext // HTML context of the block (for AutoescapeContextual)
 }
 
-func (node *tagBlockNode) getBlockWrappers(tpl *Template) []*NodeWrapper {
+// getBlockWrappers returns the block's wrappers of tpl and its children
+// (within the inheritance chain of the current execution).
+func (node *tagBlockNode) getBlockWrappers(ctx *ExecutionContext, tpl *Template) ([]*NodeWrapper, *Error) {
 	nodeWrappers := make([]*NodeWrapper, 0)
-	var t *NodeWrapper
 
-	for tpl != nil {
-		t = tpl.blocks[node.name]
-		if t != nil {
-			nodeWrappers = append(nodeWrappers, t)
+	inheritance := []*Template{tpl}
+	for idx, t := range ctx.inheritance {
+		if t == tpl {
+			inheritance = ctx.inheritance[idx:]
+			break
 		}
-		tpl = tpl.child
 	}
 
-	return nodeWrappers
+	for _, t := range inheritance {
+		if wrapper := t.blocks[node.name]; wrapper != nil {
+			// Blocks of children with a dynamic parent are parsed without knowing
+			// the HTML context of the parent's block
+			if ctx.escapesContextually() && t.blockContexts[node.name].canonical() != node.escapeContext.canonical() {
+				return nil, ctx.Error(fmt.Sprintf("Block '%s' of template '%s' is placed in a different HTML context than it was compiled for (contextual autoescaping requires a static parent).",
+					node.name, t.name), node.position)
+			}
+			nodeWrappers = append(nodeWrappers, wrapper)
+		}
+	}
+
+	return nodeWrappers, nil
 }
 
 func (node *tagBlockNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
@@ -30,7 +45,10 @@ func (node *tagBlockNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 	}
 
 	// Determine the block to execute
-	blockWrappers := node.getBlockWrappers(tpl)
+	blockWrappers, err := node.getBlockWrappers(ctx, tpl)
+	if err != nil {
+		return err
+	}
 	lenBlockWrappers := len(blockWrappers)
 
 	if lenBlockWrappers == 0 {
@@ -42,7 +60,7 @@ func (node *tagBlockNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 		ctx:      ctx,
 		wrappers: blockWrappers[0 : lenBlockWrappers-1],
 	}
-	err := blockWrapper.Execute(ctx, writer)
+	err = blockWrapper.Execute(ctx, writer)
 	if err != nil {
 		return err
 	}
@@ -50,6 +68,17 @@ func (node *tagBlockNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 	return nil
 }
 
+// parentBlockContext returns the HTML context of the block within the static
+// parents of tpl (if any of them defines it).
+func parentBlockContext(tpl *Template, name string) (escapeContext, bool) {
+	for t := tpl.parent; t != nil; t = t.parent {
+		if ec, has := t.blockContexts[name]; has {
+			return ec, true
+		}
+	}
+	return escapeContext{}, false
+}
+
 type tagBlockInformation struct {
 	ctx      *ExecutionContext
 	wrappers []*NodeWrapper
@@ -92,6 +121,24 @@ func tagBlockParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Er
 		return nil, arguments.Error("Tag 'block' takes exactly 1 argument (an identifier).", nil)
 	}
 
+	tpl := doc.template
+	if tpl == nil {
+		panic("internal error: tpl == nil")
+	}
+
+	// A block overriding a block of a parent is rendered at the parent's position,
+	// so its HTML context continues from there
+	escapeCtx := doc.escapeContext
+	parentEscapeCtx, overrides := parentBlockContext(tpl, nameToken.Val)
+	if overrides {
+		doc.escapeContext = parentEscapeCtx
+	}
+	blockNode := &tagBlockNode{
+		position:      start,
+		name:          nameToken.Val,
+		escapeContext: doc.escapeContext,
+	}
+
 	wrapper, endtagargs, err := doc.WrapUntilTag("endblock")
 	if err != nil {
 		return nil, err
@@ -110,18 +157,18 @@ func tagBlockParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Er
 		}
 	}
 
-	tpl := doc.template
-	if tpl == nil {
-		panic("internal error: tpl == nil")
-	}
 	_, hasBlock := tpl.blocks[nameToken.Val]
 	if !hasBlock {
 		tpl.blocks[nameToken.Val] = wrapper
+		tpl.blockContexts[nameToken.Val] = blockNode.escapeContext
 	} else {
 		return nil, arguments.Error(fmt.Sprintf("Block named '%s' already defined", nameToken.Val), nil)
 	}
+	if overrides {
+		doc.escapeContext = escapeCtx
+	}
 
-	return &tagBlockNode{name: nameToken.Val}, nil
+	return blockNode, nil
 }
 
 func init() {
@@ -0,0 +1,24 @@
+package pongo2
+
+type tagBreakNode struct {
+	position *Token
+}
+
+func (node *tagBreakNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	if ctx.loopControl == nil {
+		return ctx.Error("'break' must be used within a for-loop.", node.position)
+	}
+	ctx.loopControl.signal = loopSignalBreak
+	return nil
+}
+
+func tagBreakParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("Tag 'break' does not take any argument.", nil)
+	}
+	return &tagBreakNode{position: start}, nil
+}
+
+func init() {
+	RegisterTag("break", tagBreakParser)
+}
@@ -0,0 +1,132 @@
+package pongo2
+
+import (
+	"fmt"
+)
+
+// tagCallNode implements {% call macro(args) %}...{% endcall %}; the macro can
+// render the content of the call-block by calling `caller()`. Arguments passed
+// to caller() are available under the names given by {% call(a, b) macro() %}.
+type tagCallNode struct {
+	position      *Token
+	params        []string
+	macro         *variableResolver
+	wrapper       *NodeWrapper
+	escapeContext escapeContext // HTML context of the tag (for AutoescapeContextual)
+}
+
+// macroCaller is passed as an additional (last) argument to the macro
+// called by a call-block; see tagMacroNode.call.
+type macroCaller struct {
+	ctx  *ExecutionContext // context of the call-block
+	node *tagCallNode
+}
+
+// callerArgument evaluates to the macroCaller of the executed call-block.
+type callerArgument struct {
+	node *tagCallNode
+}
+
+func (arg *callerArgument) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
+	return AsValue(&macroCaller{ctx: ctx, node: arg.node}), nil
+}
+
+// call renders the content of the call-block.
+func (c *macroCaller) call(args ...*Value) (*Value, error) {
+	if len(args) > len(c.node.params) {
+		return nil, c.ctx.Error(fmt.Sprintf("caller() called with too many arguments (%d instead of %d).",
+			len(args), len(c.node.params)), c.node.position)
+	}
+
+	callerCtx := NewChildExecutionContext(c.ctx)
+	for idx, name := range c.node.params {
+		if idx < len(args) {
+			callerCtx.Private[name] = args[idx] // keeps the safe-flag
+		} else {
+			callerCtx.Private[name] = nil
+		}
+	}
+
+	btw := getBufferedTemplateWriter()
+	defer putBufferedTemplateWriter(btw)
+	if err := c.node.wrapper.Execute(callerCtx, btw.tw); err != nil {
+		return nil, err
+	}
+
+	return AsSafeValue(btw.buf.String()), nil
+}
+
+func (node *tagCallNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	value, err := node.macro.Evaluate(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx.writeValue(writer, value, false, node.escapeContext)
+	return nil
+}
+
+func tagCallParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	callNode := &tagCallNode{
+		position:      start,
+		escapeContext: doc.escapeContext,
+	}
+
+	// Parameters of caller(), e. g. {% call(user) list_users(users) %}
+	if arguments.Match(TokenSymbol, "(") != nil {
+		for arguments.Match(TokenSymbol, ")") == nil {
+			paramToken := arguments.MatchType(TokenIdentifier)
+			if paramToken == nil {
+				return nil, arguments.Error("Expected parameter name as identifier.", nil)
+			}
+			callNode.params = append(callNode.params, paramToken.Val)
+
+			if arguments.Match(TokenSymbol, ")") != nil {
+				break
+			}
+			if arguments.Match(TokenSymbol, ",") == nil {
+				return nil, arguments.Error("Expected ',' or ')'.", nil)
+			}
+		}
+	}
+
+	if arguments.Remaining() == 0 {
+		return nil, arguments.Error("Call-tag needs a macro call.", nil)
+	}
+	expr, err := arguments.parseVariableOrLiteral()
+	if err != nil {
+		return nil, err
+	}
+	resolver, ok := expr.(*variableResolver)
+	if !ok || len(resolver.parts) == 0 || !resolver.parts[len(resolver.parts)-1].isFunctionCall {
+		return nil, arguments.Error("Call-tag needs a macro call (like 'macro(args)').", expr.GetPositionToken())
+	}
+	callNode.macro = resolver
+
+	// The macro receives the call-block as its last argument
+	lastPart := resolver.parts[len(resolver.parts)-1]
+	lastPart.callingArgs = append(lastPart.callingArgs, &callerArgument{node: callNode})
+
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("Malformed call-tag.", nil)
+	}
+
+	wrapper, endargs, err := doc.WrapUntilTag("endcall")
+	if err != nil {
+		return nil, err
+	}
+	callNode.wrapper = wrapper
+
+	// The block is rendered by the macro; the output of the call is at the tag's position
+	doc.escapeContext = callNode.escapeContext.afterValue()
+
+	if endargs.Count() > 0 {
+		return nil, endargs.Error("Arguments not allowed here.", nil)
+	}
+
+	return callNode, nil
+}
+
+func init() {
+	RegisterTag("call", tagCallParser)
+}
@@ -0,0 +1,24 @@
+package pongo2
+
+type tagContinueNode struct {
+	position *Token
+}
+
+func (node *tagContinueNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	if ctx.loopControl == nil {
+		return ctx.Error("'continue' must be used within a for-loop.", node.position)
+	}
+	ctx.loopControl.signal = loopSignalContinue
+	return nil
+}
+
+func tagContinueParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error("Tag 'continue' does not take any argument.", nil)
+	}
+	return &tagContinueNode{position: start}, nil
+}
+
+func init() {
+	RegisterTag("continue", tagContinueParser)
+}
@@ -2,24 +2,34 @@ package pongo2
 
 type tagCycleValue struct {
 	node  *tagCycleNode
+	state *tagCycleState
 	value *Value
 }
 
 type tagCycleNode struct {
 	position *Token
 	args     []IEvaluator
-	idx      int
 	asName   string
 	silent   bool
 }
 
+// tagCycleState is the position of a cycle-tag within an execution.
+type tagCycleState struct {
+	idx int
+}
+
+func newTagCycleState() any {
+	return &tagCycleState{}
+}
+
 func (cv *tagCycleValue) String() string {
 	return cv.value.String()
 }
 
 func (node *tagCycleNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	item := node.args[node.idx%len(node.args)]
-	node.idx++
+	state := ctx.nodeState(node, newTagCycleState).(*tagCycleState)
+	item := node.args[state.idx%len(node.args)]
+	state.idx++
 
 	val, err := item.Evaluate(ctx)
 	if err != nil {
@@ -31,8 +41,8 @@ func (node *tagCycleNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 		// {% cycle cycleitem %}
 
 		// Update the cycle value with next value
-		item := t.node.args[t.node.idx%len(t.node.args)]
-		t.node.idx++
+		item := t.node.args[t.state.idx%len(t.node.args)]
+		t.state.idx++
 
 		val, err := item.Evaluate(ctx)
 		if err != nil {
@@ -49,6 +59,7 @@ func (node *tagCycleNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 
 		cycleValue := &tagCycleValue{
 			node:  node,
+			state: state,
 			value: val,
 		}
 
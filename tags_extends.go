@@ -1,49 +1,129 @@
 package pongo2
 
+import (
+	"fmt"
+	"strings"
+)
+
 type tagExtendsNode struct {
+	position *Token
 	filename string
+	parent   *Template // only for a static parent: {% extends "base.html" %}
+
+	// Only for a dynamic parent which is evaluated on every execution: either
+	// a filename, a list of filenames (the first existing one is used) or a *Template
+	parentEvaluator IEvaluator
 }
 
 func (node *tagExtendsNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
 	return nil
 }
 
+// getParent returns the parent template of tpl for the current execution.
+func (node *tagExtendsNode) getParent(ctx *ExecutionContext, tpl *Template) (*Template, *Error) {
+	if node.parent != nil {
+		return node.parent, nil
+	}
+
+	evalCtx := NewChildExecutionContext(ctx)
+	evalCtx.template = tpl
+	value, err := node.parentEvaluator.Evaluate(evalCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	if parent, ok := value.Interface().(*Template); ok {
+		return parent, nil
+	}
+
+	var candidates []string
+	switch {
+	case value.IsString():
+		candidates = append(candidates, value.String())
+	case value.CanSlice():
+		for i := 0; i < value.Len(); i++ {
+			candidates = append(candidates, value.Index(i).String())
+		}
+	default:
+		return nil, evalCtx.Error(fmt.Sprintf("Tag 'extends' requires a template filename or a list of filenames (got %s).",
+			value.String()), node.position)
+	}
+	if len(candidates) == 0 {
+		return nil, evalCtx.Error("Tag 'extends' got an empty list of filenames.", node.position)
+	}
+
+	set := tpl.set
+	for idx, candidate := range candidates {
+		filename := set.resolveFilename(tpl, candidate)
+
+		// Fall back to the next candidate if the template doesn't exist
+		if idx < len(candidates)-1 {
+			if !set.templateExists(filename) {
+				continue
+			}
+		}
+
+		parent, err := set.referencedTemplate(filename)
+		if err != nil {
+			return nil, err.(*Error).updateFromTokenIfNeeded(tpl, node.position)
+		}
+		return parent, nil
+	}
+
+	return nil, evalCtx.Error(fmt.Sprintf("None of the parent templates exists (%s).", strings.Join(candidates, ", ")), node.position)
+}
+
 func tagExtendsParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
-	extendsNode := &tagExtendsNode{}
+	extendsNode := &tagExtendsNode{
+		position: start,
+	}
 
 	if doc.template.level > 1 {
 		return nil, arguments.Error("The 'extends' tag can only defined on root level.", start)
 	}
 
-	if doc.template.parent != nil {
+	if doc.template.extends != nil {
 		// Already one parent
 		return nil, arguments.Error("This template has already one parent.", start)
 	}
 
-	if filenameToken := arguments.MatchType(TokenString); filenameToken != nil {
+	if arguments.Remaining() == 0 {
+		return nil, arguments.Error("Tag 'extends' requires a template filename.", nil)
+	}
+
+	if filenameToken := arguments.PeekType(TokenString); filenameToken != nil && arguments.Remaining() == 1 {
 		// prepared, static template
+		arguments.Consume()
 
 		// Get parent's filename
 		parentFilename := doc.template.set.resolveFilename(doc.template, filenameToken.Val)
 
 		// Parse the parent
-		parentTemplate, err := doc.template.set.FromFile(parentFilename)
+		parentTemplate, err := doc.template.set.compileReference(parentFilename)
 		if err != nil {
 			return nil, err.(*Error)
 		}
+		doc.template.addDependency(parentFilename, parentTemplate)
 
 		// Keep track of things
-		parentTemplate.child = doc.template
 		doc.template.parent = parentTemplate
 		extendsNode.filename = parentFilename
+		extendsNode.parent = parentTemplate
 	} else {
-		return nil, arguments.Error("Tag 'extends' requires a template filename as string.", nil)
+		// dynamic template, resolved on every execution
+		parentEvaluator, err := arguments.ParseExpression()
+		if err != nil {
+			return nil, err
+		}
+		extendsNode.parentEvaluator = parentEvaluator
 	}
 
 	if arguments.Remaining() > 0 {
 		return nil, arguments.Error("Tag 'extends' does only take 1 argument.", nil)
 	}
 
+	doc.template.extends = extendsNode
+
 	return extendsNode, nil
 }
 
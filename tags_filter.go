@@ -1,8 +1,13 @@
 package pongo2
 
+import (
+	"fmt"
+)
+
 type nodeFilterCall struct {
 	name      string
 	paramExpr IEvaluator
+	filterFn  FilterFunction
 }
 
 type tagFilterNode struct {
@@ -32,7 +37,7 @@ func (node *tagFilterNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 		} else {
 			param = AsValue(nil)
 		}
-		value, err = ApplyFilter(call.name, value, param)
+		value, err = call.filterFn(value, param)
 		if err != nil {
 			return ctx.Error(err.Error(), node.position)
 		}
@@ -63,6 +68,15 @@ func tagFilterParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *E
 		}
 		filterCall.name = nameToken.Val
 
+		filterFn, exists := doc.template.set.getFilter(nameToken.Val)
+		if !exists {
+			return nil, arguments.Error(fmt.Sprintf("Filter '%s' does not exist.", nameToken.Val), nameToken)
+		}
+		if !doc.template.set.filterAllowed(nameToken.Val) {
+			return nil, arguments.Error(fmt.Sprintf("Usage of filter '%s' is not allowed (sandbox restriction active).", nameToken.Val), nameToken)
+		}
+		filterCall.filterFn = filterFn
+
 		if arguments.MatchOne(TokenSymbol, ":") != nil {
 			// Filter parameter
 			// NOTICE: we can't use ParseExpression() here, because it would parse the next filter "|..." as well in the argument list
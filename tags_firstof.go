@@ -1,8 +1,9 @@
 package pongo2
 
 type tagFirstofNode struct {
-	position *Token
-	args     []IEvaluator
+	position      *Token
+	args          []IEvaluator
+	escapeContext escapeContext // HTML context of the tag (for AutoescapeContextual)
 }
 
 func (node *tagFirstofNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
@@ -13,14 +14,7 @@ func (node *tagFirstofNode) Execute(ctx *ExecutionContext, writer TemplateWriter
 		}
 
 		if val.IsTrue() {
-			if ctx.Autoescape && !arg.FilterApplied("safe") {
-				val, err = ApplyFilter("escape", val, nil)
-				if err != nil {
-					return err
-				}
-			}
-
-			writer.WriteAny(val)
+			ctx.writeValue(writer, val, arg.FilterApplied("safe"), node.escapeContext)
 			return nil
 		}
 	}
@@ -30,8 +24,10 @@ func (node *tagFirstofNode) Execute(ctx *ExecutionContext, writer TemplateWriter
 
 func tagFirstofParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
 	firstofNode := &tagFirstofNode{
-		position: start,
+		position:      start,
+		escapeContext: doc.escapeContext,
 	}
+	doc.escapeContext = doc.escapeContext.afterValue()
 
 	for arguments.Remaining() > 0 {
 		node, err := arguments.ParseExpression()
@@ -1,39 +1,217 @@
 package pongo2
 
 type tagForNode struct {
+	position        *Token
 	key             string
 	value           string // only for maps: for key, value in map
 	objectEvaluator IEvaluator
 	reversed        bool
 	sorted          bool
+	condition       IEvaluator // only for filtered loops: for x in items if condition
 
 	bodyWrapper  *NodeWrapper
 	emptyWrapper *NodeWrapper
 }
 
+// loopControl is shared by all ExecutionContexts executing a for-loop's body
+// (including included templates) and signals a {% break %} or {% continue %}.
+type loopControl struct {
+	signal int
+}
+
+const (
+	loopSignalNone = iota
+	loopSignalBreak
+	loopSignalContinue
+)
+
+// interrupted returns true if the remaining nodes of the loop body must be skipped.
+func (lc *loopControl) interrupted() bool {
+	return lc != nil && lc.signal != loopSignalNone
+}
+
 type tagForLoopInformation struct {
-	Counter     int
-	Counter0    int
-	Revcounter  int
-	Revcounter0 int
-	First       bool
-	Last        bool
-	Parentloop  *tagForLoopInformation
+	Counter    int
+	Counter0   int
+	First      bool
+	Depth      int // nesting level of the loop, starting at 1
+	Depth0     int // nesting level of the loop, starting at 0
+	PrevItem   *Value
+	Parentloop *tagForLoopInformation
+
+	// Length, Revcounter, Revcounter0, Last and NextItem are methods since a
+	// filtered loop only determines them on demand
+	length   int
+	nextItem *Value
+	filtered *filteredItems // only for filtered loops
+
+	lastChanged []*Value
+}
+
+// Length returns the number of items of the loop.
+func (loopInfo *tagForLoopInformation) Length() (int, error) {
+	if loopInfo.filtered != nil {
+		return loopInfo.filtered.length()
+	}
+	return loopInfo.length, nil
+}
+
+// Revcounter returns the number of iterations from the end of the loop (1-indexed).
+func (loopInfo *tagForLoopInformation) Revcounter() (int, error) {
+	length, err := loopInfo.Length()
+	return length - loopInfo.Counter0, err
+}
+
+// Revcounter0 returns the number of iterations from the end of the loop (0-indexed).
+func (loopInfo *tagForLoopInformation) Revcounter0() (int, error) {
+	length, err := loopInfo.Length()
+	return length - loopInfo.Counter, err
+}
+
+// Last returns true for the last iteration of the loop.
+func (loopInfo *tagForLoopInformation) Last() (bool, error) {
+	if loopInfo.filtered != nil {
+		next, err := loopInfo.filtered.get(loopInfo.Counter)
+		if err != nil {
+			return false, err
+		}
+		return next == nil, nil
+	}
+	return loopInfo.Counter == loopInfo.length, nil
+}
+
+// NextItem returns the item of the next iteration (nil for the last iteration).
+func (loopInfo *tagForLoopInformation) NextItem() (*Value, error) {
+	if loopInfo.filtered != nil {
+		next, err := loopInfo.filtered.get(loopInfo.Counter)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			return AsValue(nil), nil
+		}
+		return loopInfo.filtered.node.loopItem(next), nil
+	}
+	if loopInfo.nextItem == nil {
+		return AsValue(nil), nil
+	}
+	return loopInfo.nextItem, nil
+}
+
+// Cycle returns the argument at the position of the current iteration
+// (modulo the number of arguments), e. g. forloop.Cycle("odd", "even").
+func (loopInfo *tagForLoopInformation) Cycle(args ...*Value) *Value {
+	if len(args) == 0 {
+		return AsValue(nil)
+	}
+	return args[loopInfo.Counter0%len(args)]
+}
+
+// Changed returns true if it's called for the first time or if
+// any of the given values changed since its last call.
+func (loopInfo *tagForLoopInformation) Changed(values ...*Value) bool {
+	changed := loopInfo.lastChanged == nil || len(loopInfo.lastChanged) != len(values)
+	if !changed {
+		for idx, last := range loopInfo.lastChanged {
+			if !last.EqualValueTo(values[idx]) {
+				changed = true
+				break
+			}
+		}
+	}
+	loopInfo.lastChanged = make([]*Value, 0, len(values))
+	for _, v := range values {
+		loopInfo.lastChanged = append(loopInfo.lastChanged, copyValue(v))
+	}
+	return changed
+}
+
+// forItem is an item of the iterated object; the values are copies
+// since Value.IterateOrder reuses its values.
+type forItem struct {
+	key, value *Value
+}
+
+// filteredItems are the items of a filtered loop ({% for x in items if cond %}).
+// The condition of an item is only evaluated once the item is needed, so the
+// loop's body can influence the conditions of the following items. forloop.Last
+// and forloop.NextItem look ahead to the next matching item, forloop.Length
+// (and Revcounter) evaluates the conditions of all items.
+type filteredItems struct {
+	node    *tagForNode
+	ctx     *ExecutionContext
+	items   []*forItem // all items of the iterated object
+	checked int        // number of items whose condition has been evaluated
+	matches []*forItem
+}
+
+// get returns the matching item at idx (nil if there are less matching items).
+func (f *filteredItems) get(idx int) (*forItem, *Error) {
+	for len(f.matches) <= idx && f.checked < len(f.items) {
+		item := f.items[f.checked]
+		f.checked++
+
+		// Stop iterating if the execution has been cancelled
+		if err := f.ctx.checkAborted(f.node.position); err != nil {
+			return nil, err
+		}
+		if err := f.ctx.countIteration(f.node.position); err != nil {
+			return nil, err
+		}
+
+		// The loop variables of the current iteration are kept
+		condCtx := NewChildExecutionContext(f.ctx)
+		condCtx.Private[f.node.key] = item.key
+		if item.value != nil {
+			condCtx.Private[f.node.value] = item.value
+		}
+		cond, err := f.node.condition.Evaluate(condCtx)
+		if err != nil {
+			return nil, err
+		}
+		if cond.IsTrue() {
+			f.matches = append(f.matches, item)
+		}
+	}
+	if idx < len(f.matches) {
+		return f.matches[idx], nil
+	}
+	return nil, nil
+}
+
+// length returns the number of matching items.
+func (f *filteredItems) length() (int, error) {
+	if _, err := f.get(len(f.items)); err != nil {
+		return 0, err
+	}
+	return len(f.matches), nil
+}
+
+// copyValue copies a (pooled) Value.
+func copyValue(v *Value) *Value {
+	if v == nil {
+		return nil
+	}
+	return &Value{val: v.val, safe: v.safe, undefined: v.undefined}
 }
 
 func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) (forError *Error) {
 	// Backup forloop (as parentloop in public context), key-name and value-name
 	forCtx := NewChildExecutionContext(ctx)
+	forCtx.loopControl = &loopControl{}
 	parentloop := forCtx.Private["forloop"]
 
 	// Create loop struct
 	loopInfo := &tagForLoopInformation{
 		First: true,
+		Depth: 1,
 	}
 
 	// Is it a loop in a loop?
 	if parentloop != nil {
 		loopInfo.Parentloop = parentloop.(*tagForLoopInformation)
+		loopInfo.Depth = loopInfo.Parentloop.Depth + 1
+		loopInfo.Depth0 = loopInfo.Depth - 1
 	}
 
 	// Register loopInfo in public context
@@ -44,47 +222,146 @@ func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) (f
 		return err
 	}
 
-	obj.IterateOrder(func(idx, count int, key, value *Value) bool {
-		// There's something to iterate over (correct type and at least 1 item)
+	if node.condition != nil {
+		return node.executeFiltered(forCtx, ctx.loopControl, loopInfo, obj, writer)
+	}
 
-		// Update loop infos and public context
-		forCtx.Private[node.key] = key
-		if value != nil {
-			forCtx.Private[node.value] = value
-		}
-		loopInfo.Counter = idx + 1
-		loopInfo.Counter0 = idx
-		if idx == 1 {
-			loopInfo.First = false
-		}
-		if idx+1 == count {
-			loopInfo.Last = true
-		}
-		loopInfo.Revcounter = count - idx        // TODO: Not sure about this, have to look it up
-		loopInfo.Revcounter0 = count - (idx + 1) // TODO: Not sure about this, have to look it up
+	// The body of an item is executed once the next item is known (for forloop.NextItem)
+	var pending *forItem
+	var stopped bool
+	var total int
 
-		// Render elements with updated context
-		err := node.bodyWrapper.Execute(forCtx, writer)
-		if err != nil {
-			forError = err
-			return false
-		}
-		return true
-	}, func() {
-		// Nothing to iterate over (maybe wrong type or no items)
-		if node.emptyWrapper != nil {
-			err := node.emptyWrapper.Execute(forCtx, writer)
+	obj.IterateOrder(func(idx, count int, key, value *Value) bool {
+		// There's something to iterate over (correct type and at least 1 item)
+		total = count
+		item := &forItem{key: copyValue(key), value: copyValue(value)}
+		if pending != nil {
+			continueLoop, err := node.executeItem(forCtx, loopInfo, idx-1, count, pending, item, writer)
 			if err != nil {
 				forError = err
+				return false
+			}
+			if !continueLoop {
+				stopped = true
+				return false
 			}
 		}
+		pending = item
+		return true
+	}, func() {
+		// Nothing to iterate over (maybe wrong type or no items)
+		forError = node.executeEmpty(forCtx, ctx.loopControl, writer)
 	}, node.reversed, node.sorted)
 
+	if forError == nil && !stopped && pending != nil {
+		_, forError = node.executeItem(forCtx, loopInfo, total-1, total, pending, nil, writer)
+	}
+
 	return forError
 }
 
+// executeFiltered runs the loop only for the items matching the loop's condition
+// ({% for x in items if x.active %}); forloop reflects the filtered sequence.
+// The conditions are evaluated lazily (see filteredItems).
+func (node *tagForNode) executeFiltered(forCtx *ExecutionContext, outerControl *loopControl, loopInfo *tagForLoopInformation, obj *Value, writer TemplateWriter) *Error {
+	filtered := &filteredItems{node: node, ctx: forCtx}
+	obj.IterateOrder(func(idx, count int, key, value *Value) bool {
+		filtered.items = append(filtered.items, &forItem{key: copyValue(key), value: copyValue(value)})
+		return true
+	}, func() {}, node.reversed, node.sorted)
+	loopInfo.filtered = filtered
+
+	for idx := 0; ; idx++ {
+		item, err := filtered.get(idx)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			if idx == 0 {
+				return node.executeEmpty(forCtx, outerControl, writer)
+			}
+			return nil
+		}
+		continueLoop, err := node.executeBody(forCtx, loopInfo, idx, item, writer)
+		if err != nil {
+			return err
+		}
+		if !continueLoop {
+			return nil
+		}
+	}
+}
+
+// executeItem counts the iteration (the look-ahead item isn't counted before
+// its body runs) and renders the loop body for item of an unfiltered loop
+// (next is nil for the last item).
+func (node *tagForNode) executeItem(forCtx *ExecutionContext, loopInfo *tagForLoopInformation, idx, count int, item, next *forItem, writer TemplateWriter) (bool, *Error) {
+	// Stop iterating if the execution has been cancelled
+	if err := forCtx.checkAborted(node.position); err != nil {
+		return false, err
+	}
+	if err := forCtx.countIteration(node.position); err != nil {
+		return false, err
+	}
+
+	loopInfo.length = count
+	loopInfo.nextItem = nil
+	if next != nil {
+		loopInfo.nextItem = node.loopItem(next)
+	}
+	return node.executeBody(forCtx, loopInfo, idx, item, writer)
+}
+
+// executeBody renders the loop body for a single item.
+// It returns false if the loop has to be stopped (due to a {% break %}).
+func (node *tagForNode) executeBody(forCtx *ExecutionContext, loopInfo *tagForLoopInformation, idx int, item *forItem, writer TemplateWriter) (bool, *Error) {
+	// Update loop infos and public context
+	forCtx.Private[node.key] = item.key
+	if item.value != nil {
+		forCtx.Private[node.value] = item.value
+	}
+	loopInfo.Counter = idx + 1
+	loopInfo.Counter0 = idx
+	if idx == 1 {
+		loopInfo.First = false
+	}
+
+	// Render elements with updated context
+	err := node.bodyWrapper.Execute(forCtx, writer)
+	if err != nil {
+		return false, err
+	}
+	loopInfo.PrevItem = node.loopItem(item)
+
+	signal := forCtx.loopControl.signal
+	forCtx.loopControl.signal = loopSignalNone
+	return signal != loopSignalBreak, nil
+}
+
+// loopItem returns the value of item for forloop.PrevItem and forloop.NextItem:
+// the value in a two-variable loop over a map (for key, value in map), the
+// key (the only loop variable) otherwise.
+func (node *tagForNode) loopItem(item *forItem) *Value {
+	if node.value != "" && item.value != nil {
+		return item.value
+	}
+	return item.key
+}
+
+func (node *tagForNode) executeEmpty(forCtx *ExecutionContext, outerControl *loopControl, writer TemplateWriter) *Error {
+	if node.emptyWrapper == nil {
+		return nil
+	}
+	// {% break %} and {% continue %} within the empty-block belong to the outer loop (if any)
+	emptyCtx := NewChildExecutionContext(forCtx)
+	emptyCtx.loopControl = outerControl
+	return node.emptyWrapper.Execute(emptyCtx, writer)
+}
+
 func tagForParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
-	forNode := &tagForNode{}
+	forNode := &tagForNode{
+		position: start,
+	}
 
 	// Arguments parsing
 	var valueToken *Token
@@ -105,7 +382,8 @@ func tagForParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Erro
 		return nil, arguments.Error("Expected keyword 'in'.", nil)
 	}
 
-	objectEvaluator, err := arguments.ParseExpression()
+	// The loop's condition must not be parsed as an inline conditional
+	objectEvaluator, err := arguments.parseOrExpression()
 	if err != nil {
 		return nil, err
 	}
@@ -123,12 +401,23 @@ func tagForParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Erro
 		forNode.sorted = true
 	}
 
+	if arguments.Match(TokenIdentifier, "if") != nil {
+		if arguments.Remaining() == 0 {
+			return nil, arguments.Error("Expected a condition after 'if'.", nil)
+		}
+		condition, err := arguments.ParseExpression()
+		if err != nil {
+			return nil, err
+		}
+		forNode.condition = condition
+	}
+
 	if arguments.Remaining() > 0 {
 		return nil, arguments.Error("Malformed for-loop arguments.", nil)
 	}
 
 	// Body wrapping
-	wrapper, endargs, err := doc.WrapUntilTag("empty", "endfor")
+	wrapper, endargs, err := doc.WrapUntilTag("empty", "else", "endfor")
 	if err != nil {
 		return nil, err
 	}
@@ -138,8 +427,8 @@ func tagForParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Erro
 		return nil, endargs.Error("Arguments not allowed here.", nil)
 	}
 
-	if wrapper.Endtag == "empty" {
-		// if there's an else in the if-statement, we need the else-Block as well
+	if wrapper.Endtag == "empty" || wrapper.Endtag == "else" {
+		// if there's an empty-block (or else-block, like in Jinja), we need it as well
 		wrapper, endargs, err = doc.WrapUntilTag("endfor")
 		if err != nil {
 			return nil, err
@@ -6,13 +6,23 @@ import (
 
 type tagIfchangedNode struct {
 	watchedExpr []IEvaluator
-	lastValues  []*Value
-	lastContent []byte
 	thenWrapper *NodeWrapper
 	elseWrapper *NodeWrapper
 }
 
+// tagIfchangedState holds the last values/content of an ifchanged-tag within an execution.
+type tagIfchangedState struct {
+	lastValues  []*Value
+	lastContent []byte
+}
+
+func newTagIfchangedState() any {
+	return &tagIfchangedState{}
+}
+
 func (node *tagIfchangedNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	state := ctx.nodeState(node, newTagIfchangedState).(*tagIfchangedState)
+
 	if len(node.watchedExpr) == 0 {
 		// Check against own rendered body
 
@@ -24,12 +34,12 @@ func (node *tagIfchangedNode) Execute(ctx *ExecutionContext, writer TemplateWrit
 		}
 
 		bufBytes := btw.buf.Bytes()
-		if !bytes.Equal(node.lastContent, bufBytes) {
+		if !bytes.Equal(state.lastContent, bufBytes) {
 			// Rendered content changed, output it
 			writer.Write(bufBytes)
 			// Make a copy since we're returning the buffer to the pool
-			node.lastContent = make([]byte, len(bufBytes))
-			copy(node.lastContent, bufBytes)
+			state.lastContent = make([]byte, len(bufBytes))
+			copy(state.lastContent, bufBytes)
 		}
 	} else {
 		nowValues := make([]*Value, 0, len(node.watchedExpr))
@@ -42,16 +52,16 @@ func (node *tagIfchangedNode) Execute(ctx *ExecutionContext, writer TemplateWrit
 		}
 
 		// Compare old to new values now
-		changed := len(node.lastValues) == 0
+		changed := len(state.lastValues) == 0
 
-		for idx, oldVal := range node.lastValues {
+		for idx, oldVal := range state.lastValues {
 			if !oldVal.EqualValueTo(nowValues[idx]) {
 				changed = true
 				break // we can stop here because ONE value changed
 			}
 		}
 
-		node.lastValues = nowValues
+		state.lastValues = nowValues
 
 		if changed {
 			// Render thenWrapper
@@ -5,63 +5,83 @@ import (
 )
 
 type tagImportNode struct {
-	position *Token
-	filename string
-	macros   map[string]*tagMacroNode // alias/name -> macro instance
+	position  *Token
+	filename  string
+	namespace string                   // only for {% import "file" as namespace %}
+	macros    map[string]*tagMacroNode // alias/name -> macro instance
 }
 
 func (node *tagImportNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	var namespace map[string]any
+	if node.namespace != "" {
+		namespace = make(map[string]any, len(node.macros))
+		ctx.Private[node.namespace] = namespace
+	}
+
 	for name, macro := range node.macros {
 		func(name string, macro *tagMacroNode) {
-			ctx.Private[name] = func(args ...*Value) (*Value, error) {
-				return macro.call(ctx, args...)
+			fn := macroFunc(func(kwargs Kwargs, args ...*Value) (*Value, error) {
+				return macro.call(ctx, kwargs, args...)
+			})
+			if namespace != nil {
+				namespace[name] = fn
+			} else {
+				ctx.Private[name] = fn
 			}
 		}(name, macro)
 	}
 	return nil
 }
 
-func tagImportParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+// loadImport compiles (or takes from the set's cache) the template
+// referenced by filenameToken.
+func loadImport(doc *Parser, start, filenameToken *Token) (*tagImportNode, *Template, *Error) {
 	importNode := &tagImportNode{
 		position: start,
+		filename: doc.template.set.resolveFilename(doc.template, filenameToken.Val),
 		macros:   make(map[string]*tagMacroNode),
 	}
 
-	filenameToken := arguments.MatchType(TokenString)
-	if filenameToken == nil {
-		return nil, arguments.Error("Import-tag needs a filename as string.", nil)
+	tpl, err := doc.template.set.referencedTemplate(importNode.filename)
+	if err != nil {
+		return nil, nil, err.(*Error).updateFromTokenIfNeeded(doc.template, start)
 	}
+	doc.template.addDependency(importNode.filename, tpl)
 
-	importNode.filename = doc.template.set.resolveFilename(doc.template, filenameToken.Val)
-
-	if arguments.Remaining() == 0 {
-		return nil, arguments.Error("You must at least specify one macro to import.", nil)
-	}
+	return importNode, tpl, nil
+}
 
-	// Compile the given template
-	tpl, err := doc.template.set.FromFile(importNode.filename)
-	if err != nil {
-		return nil, err.(*Error).updateFromTokenIfNeeded(doc.template, start)
+// parseImportedMacros parses a comma-separated list of macro names
+// (with optional aliases: name as alias) or '*' for all exported macros.
+func parseImportedMacros(arguments *Parser, importNode *tagImportNode, tpl *Template) *Error {
+	if arguments.Match(TokenSymbol, "*") != nil {
+		for name, macro := range tpl.exportedMacros {
+			importNode.macros[name] = macro
+		}
+		if arguments.Remaining() > 0 {
+			return arguments.Error("Malformed import-tag.", nil)
+		}
+		return nil
 	}
 
 	for arguments.Remaining() > 0 {
 		macroNameToken := arguments.MatchType(TokenIdentifier)
 		if macroNameToken == nil {
-			return nil, arguments.Error("Expected macro name (identifier).", nil)
+			return arguments.Error("Expected macro name (identifier).", nil)
 		}
 
 		asName := macroNameToken.Val
 		if arguments.Match(TokenKeyword, "as") != nil {
 			aliasToken := arguments.MatchType(TokenIdentifier)
 			if aliasToken == nil {
-				return nil, arguments.Error("Expected macro alias name (identifier).", nil)
+				return arguments.Error("Expected macro alias name (identifier).", nil)
 			}
 			asName = aliasToken.Val
 		}
 
 		macroInstance, has := tpl.exportedMacros[macroNameToken.Val]
 		if !has {
-			return nil, arguments.Error(fmt.Sprintf("Macro '%s' not found (or not exported) in '%s'.", macroNameToken.Val,
+			return arguments.Error(fmt.Sprintf("Macro '%s' not found (or not exported) in '%s'.", macroNameToken.Val,
 				importNode.filename), macroNameToken)
 		}
 
@@ -72,8 +92,72 @@ func tagImportParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *E
 		}
 
 		if arguments.Match(TokenSymbol, ",") == nil {
-			return nil, arguments.Error("Expected ','.", nil)
+			return arguments.Error("Expected ','.", nil)
+		}
+	}
+
+	return nil
+}
+
+func tagImportParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	filenameToken := arguments.MatchType(TokenString)
+	if filenameToken == nil {
+		return nil, arguments.Error("Import-tag needs a filename as string.", nil)
+	}
+
+	if arguments.Remaining() == 0 {
+		return nil, arguments.Error("You must at least specify one macro to import.", nil)
+	}
+
+	importNode, tpl, err := loadImport(doc, start, filenameToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if arguments.Match(TokenKeyword, "as") != nil {
+		// All exported macros are accessible using the namespace (e. g. forms.input())
+		namespaceToken := arguments.MatchType(TokenIdentifier)
+		if namespaceToken == nil {
+			return nil, arguments.Error("Expected namespace name (identifier).", nil)
+		}
+		if arguments.Remaining() > 0 {
+			return nil, arguments.Error("Malformed import-tag.", nil)
 		}
+		importNode.namespace = namespaceToken.Val
+		for name, macro := range tpl.exportedMacros {
+			importNode.macros[name] = macro
+		}
+		return importNode, nil
+	}
+
+	if err := parseImportedMacros(arguments, importNode, tpl); err != nil {
+		return nil, err
+	}
+
+	return importNode, nil
+}
+
+func tagFromParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	filenameToken := arguments.MatchType(TokenString)
+	if filenameToken == nil {
+		return nil, arguments.Error("From-tag needs a filename as string.", nil)
+	}
+
+	if arguments.Match(TokenIdentifier, "import") == nil {
+		return nil, arguments.Error("Expected 'import'.", nil)
+	}
+
+	if arguments.Remaining() == 0 {
+		return nil, arguments.Error("You must at least specify one macro to import.", nil)
+	}
+
+	importNode, tpl, err := loadImport(doc, start, filenameToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := parseImportedMacros(arguments, importNode, tpl); err != nil {
+		return nil, err
 	}
 
 	return importNode, nil
@@ -81,4 +165,5 @@ func tagImportParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *E
 
 func init() {
 	RegisterTag("import", tagImportParser)
+	RegisterTag("from", tagFromParser)
 }
@@ -1,6 +1,7 @@
 package pongo2
 
 type tagIncludeNode struct {
+	position          *Token
 	tpl               *Template
 	filenameEvaluator IEvaluator
 	lazy              bool
@@ -44,7 +45,7 @@ func (node *tagIncludeNode) Execute(ctx *ExecutionContext, writer TemplateWriter
 		// Get include-filename
 		includedFilename := ctx.template.set.resolveFilename(ctx.template, filename.String())
 
-		includedTpl, err2 := ctx.template.set.FromFile(includedFilename)
+		includedTpl, err2 := ctx.template.set.compileReference(includedFilename)
 		if err2 != nil {
 			// if this is ReadFile error, and "if_exists" flag is enabled
 			if node.ifExists && err2.(*Error).Sender == "fromfile" {
@@ -52,18 +53,10 @@ func (node *tagIncludeNode) Execute(ctx *ExecutionContext, writer TemplateWriter
 			}
 			return err2.(*Error)
 		}
-		err2 = includedTpl.ExecuteWriter(includeCtx, writer)
-		if err2 != nil {
-			return err2.(*Error)
-		}
-		return nil
+		return includedTpl.executeIncluded(ctx, node.position, includeCtx, writer)
 	}
 	// Template is already parsed with static filename
-	err := node.tpl.ExecuteWriter(includeCtx, writer)
-	if err != nil {
-		return err.(*Error)
-	}
-	return nil
+	return node.tpl.executeIncluded(ctx, node.position, includeCtx, writer)
 }
 
 type tagIncludeEmptyNode struct{}
@@ -74,6 +67,7 @@ func (node *tagIncludeEmptyNode) Execute(ctx *ExecutionContext, writer TemplateW
 
 func tagIncludeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
 	includeNode := &tagIncludeNode{
+		position:  start,
 		withPairs: make(map[string]IEvaluator),
 	}
 
@@ -88,7 +82,7 @@ func tagIncludeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *
 
 		// Parse the parent
 		includeNode.filename = includedFilename
-		includedTpl, err := doc.template.set.FromFile(includedFilename)
+		includedTpl, err := doc.template.set.compileReference(includedFilename)
 		if err != nil {
 			// if this is ReadFile error, and "if_exists" token presents we should create and empty node
 			if err.(*Error).Sender == "fromfile" && ifExists {
@@ -97,6 +91,7 @@ func tagIncludeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *
 			return nil, err.(*Error).updateFromTokenIfNeeded(doc.template, filenameToken)
 		}
 		includeNode.tpl = includedTpl
+		doc.template.addDependency(includedFilename, includedTpl)
 	} else {
 		// No String, then the user wants to use lazy-evaluation (slower, but possible)
 		filenameEvaluator, err := arguments.ParseExpression()
@@ -2,6 +2,7 @@ package pongo2
 
 import (
 	"fmt"
+	"sort"
 )
 
 const maxMacroDepth = 1000
@@ -13,11 +14,21 @@ type tagMacroNode struct {
 	args      map[string]IEvaluator
 	exported  bool
 
+	// catchVarargs/catchKwargs are set by the parser if a variable of the
+	// macro's body is named varargs/kwargs; the macro then accepts surplus
+	// arguments.
+	catchVarargs bool
+	catchKwargs  bool
+
 	wrapper *NodeWrapper
 }
 
+// macroFunc is the function a macro is available as within the template
+// (and in the namespace of an import); call-tags only accept macroFuncs.
+type macroFunc func(kwargs Kwargs, args ...*Value) (*Value, error)
+
 func (node *tagMacroNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	ctx.Private[node.name] = func(args ...*Value) (*Value, error) {
+	ctx.Private[node.name] = macroFunc(func(kwargs Kwargs, args ...*Value) (*Value, error) {
 		ctx.macroDepth++
 		defer func() {
 			ctx.macroDepth--
@@ -27,13 +38,22 @@ func (node *tagMacroNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 			return nil, ctx.Error(fmt.Sprintf("maximum recursive macro call depth reached (max is %v)", maxMacroDepth), node.position)
 		}
 
-		return node.call(ctx, args...)
-	}
+		return node.call(ctx, kwargs, args...)
+	})
 
 	return nil
 }
 
-func (node *tagMacroNode) call(ctx *ExecutionContext, args ...*Value) (*Value, error) {
+func (node *tagMacroNode) call(ctx *ExecutionContext, kwargs Kwargs, args ...*Value) (*Value, error) {
+	// A macro called by a call-block gets the block as last argument
+	var caller *macroCaller
+	if len(args) > 0 {
+		if c, ok := args[len(args)-1].Interface().(*macroCaller); ok {
+			caller = c
+			args = args[:len(args)-1]
+		}
+	}
+
 	argsCtx := make(Context)
 
 	for k, v := range node.args {
@@ -52,16 +72,52 @@ func (node *tagMacroNode) call(ctx *ExecutionContext, args ...*Value) (*Value, e
 		}
 	}
 
+	varargs := []*Value{}
 	if len(args) > len(node.argsOrder) {
-		// Too many arguments, we're ignoring them and just logging into debug mode.
-		err := ctx.Error(fmt.Sprintf("Macro '%s' called with too many arguments (%d instead of %d).",
-			node.name, len(args), len(node.argsOrder)), nil).updateFromTokenIfNeeded(ctx.template, node.position)
+		if !node.catchVarargs {
+			err := ctx.Error(fmt.Sprintf("Macro '%s' called with too many arguments (%d instead of %d).",
+				node.name, len(args), len(node.argsOrder)), nil).updateFromTokenIfNeeded(ctx.template, node.position)
 
-		return AsSafeValue(""), err
+			return AsSafeValue(""), err
+		}
+		varargs = args[len(node.argsOrder):]
+		args = args[:len(node.argsOrder)]
+	}
+
+	// Keyword arguments override the defaults; unknown ones end up in kwargs
+	names := make([]string, 0, len(kwargs))
+	for name := range kwargs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	extraKwargs := make(Kwargs)
+	for _, name := range names {
+		if _, isArg := node.args[name]; !isArg {
+			if !node.catchKwargs {
+				return AsSafeValue(""), ctx.Error(fmt.Sprintf("Macro '%s' has no argument named '%s'.",
+					node.name, name), nil).updateFromTokenIfNeeded(ctx.template, node.position)
+			}
+			extraKwargs[name] = kwargs[name]
+			continue
+		}
+		for _, argName := range node.argsOrder[:len(args)] {
+			if argName == name {
+				return AsSafeValue(""), ctx.Error(fmt.Sprintf("Macro '%s' got multiple values for argument '%s'.",
+					node.name, name), nil).updateFromTokenIfNeeded(ctx.template, node.position)
+			}
+		}
+		argsCtx[name] = kwargs[name].Interface()
 	}
 
 	// Make a context for the macro execution
 	macroCtx := NewChildExecutionContext(ctx)
+	macroCtx.loopControl = nil // loops can't be controlled from within a macro
+	if caller != nil {
+		macroCtx.Private["caller"] = caller.call
+	} else {
+		delete(macroCtx.Private, "caller")
+	}
 
 	// Register all arguments in the private context
 	macroCtx.Private.Update(argsCtx)
@@ -69,6 +125,12 @@ func (node *tagMacroNode) call(ctx *ExecutionContext, args ...*Value) (*Value, e
 	for idx, argValue := range args {
 		macroCtx.Private[node.argsOrder[idx]] = argValue.Interface()
 	}
+	if node.catchVarargs {
+		macroCtx.Private["varargs"] = varargs
+	}
+	if node.catchKwargs {
+		macroCtx.Private["kwargs"] = extraKwargs
+	}
 
 	btw := getBufferedTemplateWriter()
 	defer putBufferedTemplateWriter(btw)
@@ -132,7 +194,10 @@ func tagMacroParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Er
 	}
 
 	// Body wrapping
+	outerMacro := doc.macro
+	doc.macro = macroNode
 	wrapper, endargs, err := doc.WrapUntilTag("endmacro")
+	doc.macro = outerMacro
 	if err != nil {
 		return nil, err
 	}
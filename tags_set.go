@@ -1,23 +1,70 @@
 package pongo2
 
+import (
+	"fmt"
+)
+
+// tagSetNode assigns a variable in the current scope. For-loops, with-blocks,
+// macros, call-blocks and included templates execute their content using
+// a child ExecutionContext (see NewChildExecutionContext), so assignments
+// within them aren't visible outside. Use a namespace object to carry values
+// out of these scopes:
+//
+//	{% set ns = namespace(found=false) %}
+//	{% for item in items %}{% if item.active %}{% set ns.found = true %}{% endif %}{% endfor %}
+//	{{ ns.found }}
 type tagSetNode struct {
+	position   *Token
 	name       string
-	expression IEvaluator
+	attribute  string       // only for namespace attributes: {% set ns.attribute = ... %}
+	expression IEvaluator   // nil for block captures
+	wrapper    *NodeWrapper // only for block captures: {% set name %}...{% endset %}
 }
 
 func (node *tagSetNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	// Evaluate expression
-	value, err := node.expression.Evaluate(ctx)
-	if err != nil {
-		return err
+	var value *Value
+	if node.wrapper != nil {
+		// Capture the rendered block
+		btw := getBufferedTemplateWriter()
+		defer putBufferedTemplateWriter(btw)
+		if err := node.wrapper.Execute(ctx, btw.tw); err != nil {
+			return err
+		}
+		value = AsSafeValue(btw.buf.String())
+	} else {
+		// Evaluate expression
+		var err *Error
+		value, err = node.expression.Evaluate(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if node.attribute == "" {
+		ctx.Private[node.name] = value
+		return nil
 	}
 
-	ctx.Private[node.name] = value
+	obj, has := ctx.Private[node.name]
+	if !has {
+		obj = ctx.Public[node.name]
+	}
+	if v, ok := obj.(*Value); ok {
+		obj = v.Interface()
+	}
+	ns, ok := obj.(namespace)
+	if !ok {
+		return ctx.Error(fmt.Sprintf("Can't assign attribute '%s' to '%s' since it's not a namespace (see namespace()).",
+			node.attribute, node.name), node.position)
+	}
+	ns[node.attribute] = copyValue(value)
 	return nil
 }
 
 func tagSetParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
-	node := &tagSetNode{}
+	node := &tagSetNode{
+		position: start,
+	}
 
 	// Parse variable name
 	typeToken := arguments.MatchType(TokenIdentifier)
@@ -26,6 +73,28 @@ func tagSetParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Erro
 	}
 	node.name = typeToken.Val
 
+	if arguments.Match(TokenSymbol, ".") != nil {
+		attributeToken := arguments.MatchType(TokenIdentifier)
+		if attributeToken == nil {
+			return nil, arguments.Error("Expected an attribute name (identifier) after '.'.", nil)
+		}
+		node.attribute = attributeToken.Val
+	}
+
+	if arguments.Remaining() == 0 {
+		// Block capture
+		wrapper, endargs, err := doc.WrapUntilTag("endset")
+		if err != nil {
+			return nil, err
+		}
+		node.wrapper = wrapper
+
+		if endargs.Count() > 0 {
+			return nil, endargs.Error("Arguments not allowed here.", nil)
+		}
+		return node, nil
+	}
+
 	if arguments.Match(TokenSymbol, "=") == nil {
 		return nil, arguments.Error("Expected '='.", nil)
 	}
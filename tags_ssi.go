@@ -1,8 +1,7 @@
 package pongo2
 
-import "os"
-
 type tagSSINode struct {
+	position *Token
 	filename string
 	content  string
 	template *Template
@@ -15,9 +14,9 @@ func (node *tagSSINode) Execute(ctx *ExecutionContext, writer TemplateWriter) *E
 		includeCtx.Update(ctx.Public)
 		includeCtx.Update(ctx.Private)
 
-		err := node.template.execute(includeCtx, writer)
+		err := node.template.executeIncluded(ctx, node.position, includeCtx, writer)
 		if err != nil {
-			return err.(*Error)
+			return err
 		}
 	} else {
 		// Just print out the content
@@ -27,21 +26,25 @@ func (node *tagSSINode) Execute(ctx *ExecutionContext, writer TemplateWriter) *E
 }
 
 func tagSSIParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
-	SSINode := &tagSSINode{}
+	SSINode := &tagSSINode{
+		position: start,
+	}
 
 	if fileToken := arguments.MatchType(TokenString); fileToken != nil {
 		SSINode.filename = fileToken.Val
 
 		if arguments.Match(TokenIdentifier, "parsed") != nil {
 			// parsed
-			temporaryTpl, err := doc.template.set.FromFile(doc.template.set.resolveFilename(doc.template, fileToken.Val))
+			filename := doc.template.set.resolveFilename(doc.template, fileToken.Val)
+			temporaryTpl, err := doc.template.set.compileReference(filename)
 			if err != nil {
 				return nil, err.(*Error).updateFromTokenIfNeeded(doc.template, fileToken)
 			}
 			SSINode.template = temporaryTpl
+			doc.template.addDependency(filename, temporaryTpl)
 		} else {
 			// plaintext
-			buf, err := os.ReadFile(doc.template.set.resolveFilename(doc.template, fileToken.Val))
+			filename, buf, fingerprint, err := doc.template.set.loadSource(doc.template, fileToken.Val)
 			if err != nil {
 				return nil, (&Error{
 					Sender:    "tag:ssi",
@@ -49,6 +52,7 @@ func tagSSIParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Erro
 				}).updateFromTokenIfNeeded(doc.template, fileToken)
 			}
 			SSINode.content = string(buf)
+			doc.template.addFileDependency(filename, fingerprint)
 		}
 	} else {
 		return nil, arguments.Error("First argument must be a string.", nil)
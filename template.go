@@ -2,10 +2,11 @@ package pongo2
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/CloudyKit/fastprinter"
 )
@@ -101,6 +102,14 @@ func (tw *templateWriter) WriteAny(v *Value) (int, error) {
 		return 0, nil
 	}
 
+	// SafeString and Stringer methods might be defined on the pointer receiver
+	if s, ok := safeString(v.val); ok {
+		return fastprinter.PrintString(tw.w, s)
+	}
+	if t, ok := v.val.(fmt.Stringer); ok {
+		return fastprinter.PrintString(tw.w, t.String())
+	}
+
 	// Use fastprinter's optimized functions for basic types
 	// Use type switch on resolved value to avoid reflection
 	switch val := v.getResolvedValue().(type) {
@@ -137,6 +146,8 @@ func (tw *templateWriter) WriteAny(v *Value) (int, error) {
 			return fastprinter.PrintString(tw.w, "True")
 		}
 		return fastprinter.PrintString(tw.w, "False")
+	case SafeString:
+		return fastprinter.PrintString(tw.w, val.SafeString())
 	case fmt.Stringer:
 		return fastprinter.PrintString(tw.w, val.String())
 	default:
@@ -160,11 +171,19 @@ type Template struct {
 
 	// first come, first serve (it's important to not override existing entries in here)
 	level          int
-	parent         *Template
-	child          *Template
+	parent         *Template       // only for a static parent ({% extends "base.html" %})
+	extends        *tagExtendsNode // nil if the template doesn't extend another one
 	blocks         map[string]*NodeWrapper
+	blockContexts  map[string]escapeContext // HTML context at the start of each block
 	exportedMacros map[string]*tagMacroNode
 
+	// For the change detection of TemplateSet.AutoReload
+	fingerprint  sourceFingerprint
+	dependencies []dependency
+
+	// Escapes the values if autoescaping is enabled (see TemplateSet.Escaper)
+	escaper Escaper
+
 	// Output
 	root *nodeDocument
 
@@ -188,16 +207,22 @@ func newTemplate(set *TemplateSet, name string, isTplString bool, tpl []byte) (*
 		tpl:            strTpl,
 		size:           len(strTpl),
 		blocks:         make(map[string]*NodeWrapper),
+		blockContexts:  make(map[string]escapeContext),
 		exportedMacros: make(map[string]*tagMacroNode),
 		Options:        newOptions(),
 	}
 	// Copy all settings from another Options.
 	t.Options.Update(set.Options)
+	if autoescape := atomic.LoadInt32(&set.autoescape); autoescape != autoescapeUnset {
+		t.Options.DisableAutoescape = autoescape == autoescapeOff
+	}
+	t.escaper = set.escaperForFile(name)
 
 	// Tokenize it
-	tokens, err := lex(name, strTpl)
-	if err != nil {
-		return nil, err
+	tokens, lexErr := lex(name, strTpl)
+	if lexErr != nil {
+		lexErr.Template = t
+		return nil, lexErr
 	}
 	t.tokens = tokens
 
@@ -207,7 +232,7 @@ func newTemplate(set *TemplateSet, name string, isTplString bool, tpl []byte) (*
 	}*/
 
 	// Parse it
-	err = t.parse()
+	err := t.parse()
 	if err != nil {
 		return nil, err
 	}
@@ -215,60 +240,50 @@ func newTemplate(set *TemplateSet, name string, isTplString bool, tpl []byte) (*
 	return t, nil
 }
 
-func (tpl *Template) newContextForExecution(context Context) (*Template, *ExecutionContext, error) {
-	if tpl.Options.TrimBlocks || tpl.Options.LStripBlocks {
-		// Issue #94 https://github.com/flosch/pongo2/issues/94
-		// If an application configures pongo2 template to trim_blocks,
-		// the first newline after a template tag is removed automatically (like in PHP).
-		prev := &Token{
-			Typ: TokenHTML,
-			Val: "\n",
-		}
-
-		for _, t := range tpl.tokens {
-			if tpl.Options.LStripBlocks {
-				if prev.Typ == TokenHTML && t.Typ != TokenHTML && t.Val == "{%" {
-					prev.Val = strings.TrimRight(prev.Val, "\t ")
-				}
-			}
-
-			if tpl.Options.TrimBlocks {
-				if prev.Typ != TokenHTML && t.Typ == TokenHTML && prev.Val == "%}" {
-					if len(t.Val) > 0 && t.Val[0] == '\n' {
-						t.Val = t.Val[1:len(t.Val)]
-					}
-				}
-			}
-
-			prev = t
+// sourceOf returns the source of the template with the given name. This is
+// either tpl itself, one of the templates of its inheritance chain or a
+// template loaded through the set's loaders (e. g. an included template).
+func (tpl *Template) sourceOf(name string) (string, error) {
+	if name == "" || name == tpl.name {
+		return tpl.tpl, nil
+	}
+	for t := tpl.parent; t != nil; t = t.parent {
+		if t.name == name {
+			return t.tpl, nil
 		}
 	}
 
-	// Determine the parent to be executed (for template inheritance)
-	parent := tpl
-	for parent.parent != nil {
-		parent = parent.parent
+	_, _, fd, err := tpl.set.resolveTemplate(nil, name)
+	if err != nil {
+		return "", err
+	}
+	buf, err := io.ReadAll(fd)
+	if err != nil {
+		return "", err
 	}
+	return string(buf), nil
+}
 
+func (tpl *Template) newContextForExecution(goCtx context.Context, data Context) (*Template, *ExecutionContext, error) {
 	// Create context if none is given
 	newContext := make(Context)
 	newContext.Update(tpl.set.Globals)
 
-	if context != nil {
-		newContext.Update(context)
+	if data != nil {
+		newContext.Update(data)
 
 		if len(newContext) > 0 {
 			// Check for context name syntax
 			err := newContext.checkForValidIdentifiers()
 			if err != nil {
-				return parent, nil, err
+				return tpl, nil, err
 			}
 
 			// Check for clashes with macro names
 			for k := range newContext {
 				_, has := tpl.exportedMacros[k]
 				if has {
-					return parent, nil, &Error{
+					return tpl, nil, &Error{
 						Filename:  tpl.name,
 						Sender:    "execution",
 						OrigError: fmt.Errorf("context key name '%s' clashes with macro '%s'", k, k),
@@ -279,36 +294,99 @@ func (tpl *Template) newContextForExecution(context Context) (*Template, *Execut
 	}
 
 	// Create operational context
-	ctx := newExecutionContext(parent, newContext)
+	ctx := newExecutionContext(goCtx, tpl, newContext, tpl.Options.Limits)
+
+	// Determine the parent to be executed (for template inheritance)
+	inheritance, err := tpl.resolveInheritance(ctx)
+	if err != nil {
+		return tpl, nil, err
+	}
+	ctx.template = inheritance[0]
+	ctx.inheritance = inheritance
 
-	return parent, ctx, nil
+	return inheritance[0], ctx, nil
 }
 
-func (tpl *Template) execute(context Context, writer TemplateWriter) error {
-	parent, ctx, err := tpl.newContextForExecution(context)
+// resolveInheritance returns the inheritance chain of tpl for an execution,
+// starting with the root parent and ending with tpl itself. The chain is
+// determined on every execution since parents can be dynamic ({% extends layout %}).
+func (tpl *Template) resolveInheritance(ctx *ExecutionContext) ([]*Template, *Error) {
+	inheritance := []*Template{tpl}
+	for t := tpl; t.extends != nil; {
+		parent, err := t.extends.getParent(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		for _, known := range inheritance {
+			if known == parent || (!known.isTplString && known.name == parent.name) {
+				return nil, ctx.Error(fmt.Sprintf("Template '%s' extends itself (circular inheritance).", parent.name), t.extends.position)
+			}
+		}
+		inheritance = append([]*Template{parent}, inheritance...)
+		t = parent
+	}
+	return inheritance, nil
+}
+
+// execute executes the template. If afterNode is not nil, it's called after each
+// top-level node of the root template (see ExecuteStream).
+func (tpl *Template) execute(goCtx context.Context, data Context, writer TemplateWriter, afterNode func(*ExecutionContext, INode) *Error) error {
+	parent, ctx, err := tpl.newContextForExecution(goCtx, data)
 	if err != nil {
 		return err
 	}
 
-	// Run the selected document
-	if err := parent.root.Execute(ctx, writer); err != nil {
+	if ctx.state.limits.MaxOutputBytes > 0 {
+		writer = &limitedTemplateWriter{w: writer, state: ctx.state}
+	}
+
+	if err := parent.executeRoot(ctx, writer, afterNode); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (tpl *Template) newTemplateWriterAndExecute(context Context, writer io.Writer) error {
+// executeIncluded executes the template as part of another template's
+// execution (e. g. using the include-tag). The including execution's
+// state (like limits) will be used.
+func (tpl *Template) executeIncluded(includingCtx *ExecutionContext, token *Token, data Context, writer TemplateWriter) *Error {
+	parent, ctx, err := tpl.newContextForExecution(includingCtx.goCtx, data)
+	if err != nil {
+		return err.(*Error)
+	}
+	ctx.state = includingCtx.state
+	ctx.includeDepth = includingCtx.includeDepth + 1
+	ctx.loopControl = includingCtx.loopControl // {% break %} and {% continue %} work across includes
+
+	if limit := ctx.state.limits.MaxIncludeDepth; limit > 0 && ctx.includeDepth > limit {
+		return includingCtx.OrigError(fmt.Errorf("%w (max is %d)", ErrIncludeDepthExceeded, limit), token)
+	}
+
+	return parent.executeRoot(ctx, writer, nil)
+}
+
+func (tpl *Template) executeRoot(ctx *ExecutionContext, writer TemplateWriter, afterNode func(*ExecutionContext, INode) *Error) *Error {
+	// Run the selected document
+	if err := tpl.root.execute(ctx, writer, afterNode); err != nil {
+		return err
+	}
+
+	// The last write might have exceeded the output limit
+	return ctx.checkAborted(nil)
+}
+
+func (tpl *Template) newTemplateWriterAndExecute(goCtx context.Context, data Context, writer io.Writer) error {
 	tw := getTemplateWriter(writer)
 	defer putTemplateWriter(tw)
-	return tpl.execute(context, tw)
+	return tpl.execute(goCtx, data, tw, nil)
 }
 
-func (tpl *Template) newBufferAndExecute(context Context) (*bytes.Buffer, error) {
+func (tpl *Template) newBufferAndExecute(goCtx context.Context, data Context) (*bytes.Buffer, error) {
 	// Get buffered template writer from pool
 	btw := getBufferedTemplateWriter()
 	defer putBufferedTemplateWriter(btw)
-	if err := tpl.execute(context, btw.tw); err != nil {
+	if err := tpl.execute(goCtx, data, btw.tw, nil); err != nil {
 		return nil, err
 	}
 	// Return a copy of the buffer contents since we're returning it to the pool
@@ -317,11 +395,8 @@ func (tpl *Template) newBufferAndExecute(context Context) (*bytes.Buffer, error)
 	return result, nil
 }
 
-// Executes the template with the given context and writes to writer (io.Writer)
-// on success. Context can be nil. Nothing is written on error; instead the error
-// is being returned.
-func (tpl *Template) ExecuteWriter(context Context, writer io.Writer) error {
-	buf, err := tpl.newBufferAndExecute(context)
+func (tpl *Template) executeWriter(goCtx context.Context, data Context, writer io.Writer) error {
+	buf, err := tpl.newBufferAndExecute(goCtx, data)
 	if err != nil {
 		return err
 	}
@@ -333,19 +408,41 @@ func (tpl *Template) ExecuteWriter(context Context, writer io.Writer) error {
 	return nil
 }
 
+// Executes the template with the given context and writes to writer (io.Writer)
+// on success. Context can be nil. Nothing is written on error; instead the error
+// is being returned.
+func (tpl *Template) ExecuteWriter(data Context, writer io.Writer) error {
+	return tpl.executeWriter(context.Background(), data, writer)
+}
+
+// ExecuteContext works like ExecuteWriter, but aborts the execution as soon as
+// ctx is cancelled or its deadline has passed. In this case the returned *Error
+// wraps ctx.Err(), so errors.Is(err, context.Canceled) and
+// errors.Is(err, context.DeadlineExceeded) can be used to check for it.
+// Tags and functions can access ctx through ExecutionContext.GoContext().
+func (tpl *Template) ExecuteContext(ctx context.Context, data Context, writer io.Writer) error {
+	return tpl.executeWriter(ctx, data, writer)
+}
+
 // Same as ExecuteWriter. The only difference between both functions is that
 // this function might already have written parts of the generated template in the
 // case of an execution error because there's no intermediate buffer involved for
 // performance reasons. This is handy if you need high performance template
 // generation or if you want to manage your own pool of buffers.
-func (tpl *Template) ExecuteWriterUnbuffered(context Context, writer io.Writer) error {
-	return tpl.newTemplateWriterAndExecute(context, writer)
+func (tpl *Template) ExecuteWriterUnbuffered(data Context, writer io.Writer) error {
+	return tpl.newTemplateWriterAndExecute(context.Background(), data, writer)
+}
+
+// ExecuteContextUnbuffered is the unbuffered version of ExecuteContext
+// (see ExecuteWriterUnbuffered).
+func (tpl *Template) ExecuteContextUnbuffered(ctx context.Context, data Context, writer io.Writer) error {
+	return tpl.newTemplateWriterAndExecute(ctx, data, writer)
 }
 
 // Executes the template and returns the rendered template as a []byte
-func (tpl *Template) ExecuteBytes(context Context) ([]byte, error) {
+func (tpl *Template) ExecuteBytes(data Context) ([]byte, error) {
 	// Execute template
-	buffer, err := tpl.newBufferAndExecute(context)
+	buffer, err := tpl.newBufferAndExecute(context.Background(), data)
 	if err != nil {
 		return nil, err
 	}
@@ -357,9 +454,9 @@ func (tpl *Template) ExecuteBytes(context Context) ([]byte, error) {
 }
 
 // Executes the template and returns the rendered template as a string
-func (tpl *Template) Execute(context Context) (string, error) {
+func (tpl *Template) Execute(data Context) (string, error) {
 	// Execute template
-	buffer, err := tpl.newBufferAndExecute(context)
+	buffer, err := tpl.newBufferAndExecute(context.Background(), data)
 	if err != nil {
 		return "", err
 	}
@@ -367,43 +464,35 @@ func (tpl *Template) Execute(context Context) (string, error) {
 	return buffer.String(), nil
 }
 
-func (tpl *Template) ExecuteBlocks(context Context, blocks []string) (map[string]string, error) {
-	var parents []*Template
+func (tpl *Template) ExecuteBlocks(data Context, blocks []string) (map[string]string, error) {
 	result := make(map[string]string)
 
-	parent := tpl
-	for parent != nil {
-		// We only want to execute the template if it has a block we want
-		for _, block := range blocks {
-			if _, ok := tpl.blocks[block]; ok {
-				parents = append(parents, parent)
-				break
-			}
-		}
-		parent = parent.parent
+	_, ctx, err := tpl.newContextForExecution(context.Background(), data)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, t := range parents {
-		var btw *bufferedTemplateWriter
-		var ctx *ExecutionContext
-		var err error
+	btw := getBufferedTemplateWriter()
+	defer putBufferedTemplateWriter(btw)
+
+	var writer TemplateWriter = btw.tw
+	if ctx.state.limits.MaxOutputBytes > 0 {
+		writer = &limitedTemplateWriter{w: writer, state: ctx.state}
+	}
+
+	// The block of the template nearest to tpl in the inheritance chain wins
+	for idx := len(ctx.inheritance) - 1; idx >= 0; idx-- {
+		t := ctx.inheritance[idx]
 		for _, blockName := range blocks {
 			if _, ok := result[blockName]; ok {
 				continue
 			}
 			if blockWrapper, ok := t.blocks[blockName]; ok {
-				// assign the buffered writer if we haven't done so
-				if btw == nil {
-					btw = getBufferedTemplateWriter()
-				}
-				// assign the context if we haven't done so
-				if ctx == nil {
-					_, ctx, err = t.newContextForExecution(context)
-					if err != nil {
-						return nil, err
-					}
+				bErr := blockWrapper.Execute(ctx, writer)
+				if bErr == nil {
+					// The last write might have exceeded the output limit
+					bErr = ctx.checkAborted(nil)
 				}
-				bErr := blockWrapper.Execute(ctx, btw.tw)
 				if bErr != nil {
 					return nil, bErr
 				}
@@ -411,10 +500,6 @@ func (tpl *Template) ExecuteBlocks(context Context, blocks []string) (map[string
 				btw.buf.Reset()
 			}
 		}
-		// Return buffered writer to pool if we used one
-		if btw != nil {
-			putBufferedTemplateWriter(btw)
-		}
 		// We have found all blocks
 		if len(blocks) == len(result) {
 			break
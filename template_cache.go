@@ -0,0 +1,142 @@
+package pongo2
+
+import (
+	"hash/fnv"
+	"io"
+	"time"
+)
+
+// ModTimeLoader can be implemented by a TemplateLoader to report the
+// modification time of a template. TemplateSet.AutoReload uses it to detect
+// changed templates without reading (and hashing) their sources.
+type ModTimeLoader interface {
+	ModTime(path string) (time.Time, error)
+}
+
+// sourceFingerprint identifies the version of a template's source.
+type sourceFingerprint struct {
+	modTime time.Time // zero if the loader doesn't implement ModTimeLoader
+	hash    uint64
+}
+
+// dependency is a file a template referenced while it was compiled
+// (using extends, include, import, from or ssi).
+type dependency struct {
+	filename    string
+	template    *Template         // nil for plaintext files (ssi)
+	fingerprint sourceFingerprint // only for plaintext files
+}
+
+func hashSource(buf []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(buf)
+	return h.Sum64()
+}
+
+// loadSource reads a template (or a plaintext file) through the set's loaders.
+func (set *TemplateSet) loadSource(tpl *Template, path string) (name string, buf []byte, fingerprint sourceFingerprint, err error) {
+	name, loader, fd, err := set.resolveTemplate(tpl, path)
+	if err != nil {
+		return
+	}
+	buf, err = io.ReadAll(fd)
+	if err != nil {
+		return
+	}
+	fingerprint.hash = hashSource(buf)
+	if modTimeLoader, ok := loader.(ModTimeLoader); ok {
+		fingerprint.modTime, _ = modTimeLoader.ModTime(name)
+	}
+	return
+}
+
+// sourceChanged returns true if the source of filename differs from the known
+// fingerprint (or doesn't exist anymore). The source is only read if the loader
+// can't report a modification time or if the modification time changed. If only
+// the modification time changed, it's stored in known, so the source isn't read
+// again by the next check.
+func (set *TemplateSet) sourceChanged(filename string, known *sourceFingerprint) bool {
+	for _, loader := range set.loaders {
+		name := set.resolveFilenameForLoader(loader, nil, filename)
+		var modTime time.Time
+		if modTimeLoader, ok := loader.(ModTimeLoader); ok {
+			var err error
+			modTime, err = modTimeLoader.ModTime(name)
+			if err != nil {
+				continue
+			}
+			if !known.modTime.IsZero() && modTime.Equal(known.modTime) {
+				return false
+			}
+		}
+		fd, err := loader.Get(name)
+		if err != nil {
+			continue
+		}
+		buf, err := io.ReadAll(fd)
+		if err != nil {
+			return true
+		}
+		if hashSource(buf) != known.hash {
+			return true
+		}
+		known.modTime = modTime
+		return false
+	}
+	return true
+}
+
+// isStale returns true if the source of tpl or of any of its dependencies
+// changed since tpl has been compiled.
+func (set *TemplateSet) isStale(tpl *Template) bool {
+	// The fingerprints are updated by the check
+	set.fingerprintMutex.Lock()
+	defer set.fingerprintMutex.Unlock()
+	return set.isStaleLocked(tpl)
+}
+
+func (set *TemplateSet) isStaleLocked(tpl *Template) bool {
+	if !tpl.isTplString && set.sourceChanged(tpl.name, &tpl.fingerprint) {
+		return true
+	}
+	for idx := range tpl.dependencies {
+		dep := &tpl.dependencies[idx]
+		if dep.template != nil {
+			if set.isStaleLocked(dep.template) {
+				return true
+			}
+		} else if set.sourceChanged(dep.filename, &dep.fingerprint) {
+			return true
+		}
+	}
+	return false
+}
+
+// dependsOn returns true if tpl is or (indirectly) depends on filename.
+func (tpl *Template) dependsOn(filename string) bool {
+	if tpl.name == filename {
+		return true
+	}
+	for _, dep := range tpl.dependencies {
+		if dep.filename == filename || (dep.template != nil && dep.template.dependsOn(filename)) {
+			return true
+		}
+	}
+	return false
+}
+
+// addDependency records a template referenced by tpl while it's being compiled.
+func (tpl *Template) addDependency(filename string, referenced *Template) {
+	tpl.dependencies = append(tpl.dependencies, dependency{
+		filename: filename,
+		template: referenced,
+	})
+}
+
+// addFileDependency records a plaintext file included by tpl (see the ssi tag).
+func (tpl *Template) addFileDependency(filename string, fingerprint sourceFingerprint) {
+	tpl.dependencies = append(tpl.dependencies, dependency{
+		filename:    filename,
+		fingerprint: fingerprint,
+	})
+}
@@ -2,6 +2,7 @@ package pongo2
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -9,7 +10,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 // FSLoader supports the fs.FS interface for loading templates
@@ -31,6 +35,15 @@ func (l *FSLoader) Get(path string) (io.Reader, error) {
 	return l.fs.Open(path)
 }
 
+// ModTime returns the modification time of the path (see ModTimeLoader).
+func (l *FSLoader) ModTime(path string) (time.Time, error) {
+	info, err := fs.Stat(l.fs, path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
 // LocalFilesystemLoader represents a local filesystem loader with basic
 // BaseDirectory capabilities. The access to the local filesystem is unrestricted.
 type LocalFilesystemLoader struct {
@@ -98,6 +111,83 @@ func (fs *LocalFilesystemLoader) Get(path string) (io.Reader, error) {
 	return bytes.NewReader(buf), nil
 }
 
+// ModTime returns the modification time of the path (see ModTimeLoader).
+func (fs *LocalFilesystemLoader) ModTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// Watch checks the files below the loader's base directory for changes every
+// interval and calls onChange with the path of each created, modified or
+// removed file until ctx is done (Watch returns ctx.Err() then). It's meant to
+// be run in its own goroutine, e. g. to keep a template set's cache up to date:
+//
+//	go loader.Watch(ctx, time.Second, func(path string) {
+//		set.CleanCache(path) // also removes the templates depending on path
+//	})
+func (fs *LocalFilesystemLoader) Watch(ctx context.Context, interval time.Duration, onChange func(path string)) error {
+	if fs.baseDir == "" {
+		return errors.New("watching requires a loader with a base directory")
+	}
+
+	known, err := fs.scanModTimes()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		current, err := fs.scanModTimes()
+		if err != nil {
+			// The base directory might be replaced right now; try again later
+			continue
+		}
+		for path, modTime := range current {
+			if knownModTime, has := known[path]; !has || !knownModTime.Equal(modTime) {
+				onChange(path)
+			}
+		}
+		for path := range known {
+			if _, has := current[path]; !has {
+				onChange(path)
+			}
+		}
+		known = current
+	}
+}
+
+// scanModTimes returns the modification times of all files below the base directory.
+func (fs *LocalFilesystemLoader) scanModTimes() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	err := filepath.WalkDir(fs.baseDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// The file has been removed in the meantime
+			return nil
+		}
+		modTimes[path] = info.ModTime()
+		return nil
+	})
+	return modTimes, err
+}
+
 // Abs resolves a filename relative to the base directory. Absolute paths are allowed.
 // When there's no base dir set, the absolute path to the filename
 // will be calculated based on either the provided base directory (which
@@ -126,13 +216,27 @@ func (fs *LocalFilesystemLoader) Abs(base, name string) string {
 	return filepath.Join(fs.baseDir, name)
 }
 
-// SandboxedFilesystemLoader is still WIP.
+// ErrSandboxViolation is returned by SandboxedFilesystemLoader.Get for any
+// path outside of its base directory or not matching its allowed patterns.
+var ErrSandboxViolation = errors.New("access outside of the sandbox denied")
+
+// SandboxedFilesystemLoader is a LocalFilesystemLoader which confines the
+// access to its base directory. Paths escaping it (using '..', absolute
+// paths or symlinks pointing outside of it) are rejected. Optionally, the
+// access can be restricted further to paths matching a list of
+// glob patterns (see AllowPatterns).
 type SandboxedFilesystemLoader struct {
 	*LocalFilesystemLoader
+
+	allowedPatterns []string
 }
 
 // NewSandboxedFilesystemLoader creates a new sandboxed local file system instance.
+// A base directory is required.
 func NewSandboxedFilesystemLoader(baseDir string) (*SandboxedFilesystemLoader, error) {
+	if baseDir == "" {
+		return nil, errors.New("a sandboxed filesystem loader requires a base directory")
+	}
 	fs, err := NewLocalFileSystemLoader(baseDir)
 	if err != nil {
 		return nil, err
@@ -142,39 +246,88 @@ func NewSandboxedFilesystemLoader(baseDir string) (*SandboxedFilesystemLoader, e
 	}, nil
 }
 
-// Move sandbox to a virtual fs
-
-/*
-if len(set.SandboxDirectories) > 0 {
-    defer func() {
-        // Remove any ".." or other crap
-        resolvedPath = filepath.Clean(resolvedPath)
-
-        // Make the path absolute
-        absPath, err := filepath.Abs(resolvedPath)
-        if err != nil {
-            panic(err)
-        }
-        resolvedPath = absPath
-
-        // Check against the sandbox directories (once one pattern matches, we're done and can allow it)
-        for _, pattern := range set.SandboxDirectories {
-            matched, err := filepath.Match(pattern, resolvedPath)
-            if err != nil {
-                panic("Wrong sandbox directory match pattern (see http://golang.org/pkg/path/filepath/#Match).")
-            }
-            if matched {
-                // OK!
-                return
-            }
-        }
-
-        // No pattern matched, we have to log+deny the request
-        set.logf("Access attempt outside of the sandbox directories (blocked): '%s'", resolvedPath)
-        resolvedPath = ""
-    }()
-}
-*/
+// MustNewSandboxedFilesystemLoader creates a new SandboxedFilesystemLoader instance
+// and panics if there's any error during instantiation. The parameters
+// are the same like NewSandboxedFilesystemLoader.
+func MustNewSandboxedFilesystemLoader(baseDir string) *SandboxedFilesystemLoader {
+	fs, err := NewSandboxedFilesystemLoader(baseDir)
+	if err != nil {
+		log.Panic(err)
+	}
+	return fs
+}
+
+// AllowPatterns restricts the access to paths matching at least one of the given
+// glob patterns (see filepath.Match). Patterns are matched against the path relative
+// to the base directory using forward slashes, e. g. "*.html" or "partials/*.html".
+func (fs *SandboxedFilesystemLoader) AllowPatterns(patterns ...string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid sandbox pattern '%s': %w", pattern, err)
+		}
+	}
+	fs.allowedPatterns = append(fs.allowedPatterns, patterns...)
+	return nil
+}
+
+// Abs resolves a filename relative to the base directory. The result is not
+// checked against the sandbox; this happens when calling Get.
+func (fs *SandboxedFilesystemLoader) Abs(base, name string) string {
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(fs.baseDir, name)
+}
+
+// Get reads the path's content from your local filesystem if the path
+// is located inside the sandbox.
+func (fs *SandboxedFilesystemLoader) Get(path string) (io.Reader, error) {
+	resolvedPath, err := fs.confine(path)
+	if err != nil {
+		return nil, err
+	}
+	return fs.LocalFilesystemLoader.Get(resolvedPath)
+}
+
+// ModTime returns the modification time of the path if it's located inside the sandbox.
+func (fs *SandboxedFilesystemLoader) ModTime(path string) (time.Time, error) {
+	resolvedPath, err := fs.confine(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fs.LocalFilesystemLoader.ModTime(resolvedPath)
+}
+
+// confine resolves all symlinks of name and checks the resulting path against
+// the base directory and the allowed patterns.
+func (fs *SandboxedFilesystemLoader) confine(name string) (string, error) {
+	baseDir, err := filepath.EvalSymlinks(fs.baseDir)
+	if err != nil {
+		return "", err
+	}
+
+	resolvedPath, err := filepath.EvalSymlinks(fs.Abs("", name))
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(baseDir, resolvedPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: '%s'", ErrSandboxViolation, name)
+	}
+
+	if len(fs.allowedPatterns) > 0 {
+		rel = filepath.ToSlash(rel)
+		for _, pattern := range fs.allowedPatterns {
+			if matched, _ := path.Match(pattern, rel); matched {
+				return resolvedPath, nil
+			}
+		}
+		return "", fmt.Errorf("%w: '%s' does not match any allowed pattern", ErrSandboxViolation, name)
+	}
+
+	return resolvedPath, nil
+}
 
 // HttpFilesystemLoader supports loading templates
 // from an http.FileSystem - useful for using one of several
@@ -230,3 +383,26 @@ func (h *HttpFilesystemLoader) Get(path string) (io.Reader, error) {
 
 	return h.fs.Open(fullPath)
 }
+
+// ModTime returns the modification time of the path (see ModTimeLoader).
+func (h *HttpFilesystemLoader) ModTime(path string) (time.Time, error) {
+	fullPath := path
+	if h.baseDir != "" {
+		fullPath = fmt.Sprintf(
+			"%s/%s",
+			h.baseDir,
+			fullPath,
+		)
+	}
+
+	f, err := h.fs.Open(fullPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -1,12 +1,15 @@
 package pongo2
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // TemplateLoader allows to implement a virtual file system.
@@ -37,23 +40,70 @@ type TemplateSet struct {
 	// variable during program execution (and template compilation/execution).
 	Debug bool
 
+	// If AutoReload is true (default false), FromCache() checks whether the
+	// source of a cached template or of one of its dependencies (extends,
+	// include, import, from, ssi) changed and recompiles only the stale
+	// templates. Loaders implementing ModTimeLoader (like
+	// LocalFilesystemLoader) avoid reading the sources on every check.
+	AutoReload bool
+
 	// Options allow you to change the behavior of template-engine.
 	// You can change the options before calling the Execute method.
 	Options *Options
 
+	// AccessPolicy restricts the methods and struct fields templates of this
+	// set may access. It's nil (no restrictions) by default.
+	AccessPolicy *AccessPolicy
+
+	// Escaper escapes the values of all templates of this set if autoescaping
+	// is enabled. If it's nil (default), templates use HTML escaping unless
+	// EscaperByExtension is true.
+	Escaper Escaper
+
+	// If EscaperByExtension is true (default false) and Escaper is nil, the
+	// escaper is chosen by the file extension of the template (see
+	// RegisterEscaper); templates with unknown extensions and templates created
+	// from strings use HTML escaping.
+	EscaperByExtension bool
+
 	// Sandbox features
 	// - Disallow access to specific tags and/or filters (using BanTag() and BanFilter())
+	// - Allow access to specific tags and/or filters only (using AllowTags() and AllowFilters())
 	//
-	// For efficiency reasons you can ban tags/filters only *before* you have
+	// For efficiency reasons you can ban or allow tags/filters only *before* you have
 	// added your first template to the set (restrictions are statically checked).
 	// After you added one, it's not possible anymore (for your personal security).
-	firstTemplateCreated bool
+	firstTemplateCreated int32 // accessed atomically (templates might be compiled concurrently)
 	bannedTags           map[string]bool
 	bannedFilters        map[string]bool
+	allowedTags          map[string]bool // nil if there's no allow-list
+	allowedFilters       map[string]bool // nil if there's no allow-list
+
+	// Tags, filters, tests and escapers which are only available to this set
+	// (using RegisterTag(), RegisterFilter(), RegisterTest() and RegisterEscaper())
+	tags              map[string]*tag
+	filters           map[string]FilterFunction
+	tests             map[string]TestFunction
+	escapers          map[string]Escaper
+	escaperExtensions map[string]string
 
 	// Template cache (for FromCache())
 	templateCache      map[string]*Template
 	templateCacheMutex sync.Mutex
+
+	// Cache of the templates referenced by other templates (using the import
+	// and from tags or a dynamic extends; all references if AutoReload is
+	// true), so they are only compiled once
+	referenceCache      map[string]*Template
+	referenceCacheMutex sync.Mutex
+
+	// Guards the source fingerprints of the templates (see isStale)
+	fingerprintMutex sync.Mutex
+
+	// Set by the deprecated SetAutoescape (autoescapeUnset, autoescapeOn or
+	// autoescapeOff); it's accessed atomically and overrides
+	// Options.DisableAutoescape for new templates.
+	autoescape int32
 }
 
 // NewSet can be used to create sets with different kind of templates
@@ -65,16 +115,31 @@ func NewSet(name string, loaders ...TemplateLoader) *TemplateSet {
 	}
 
 	return &TemplateSet{
-		name:          name,
-		loaders:       loaders,
-		Globals:       make(Context),
-		bannedTags:    make(map[string]bool),
-		bannedFilters: make(map[string]bool),
-		templateCache: make(map[string]*Template),
-		Options:       newOptions(),
+		name:              name,
+		loaders:           loaders,
+		Globals:           make(Context),
+		bannedTags:        make(map[string]bool),
+		bannedFilters:     make(map[string]bool),
+		tags:              make(map[string]*tag),
+		filters:           make(map[string]FilterFunction),
+		tests:             make(map[string]TestFunction),
+		escapers:          make(map[string]Escaper),
+		escaperExtensions: make(map[string]string),
+		templateCache:     make(map[string]*Template),
+		referenceCache:    make(map[string]*Template),
+		Options:           newOptions(),
 	}
 }
 
+// markTemplateCreated locks the sandbox settings (see BanTag()) since a template has been created.
+func (set *TemplateSet) markTemplateCreated() {
+	atomic.StoreInt32(&set.firstTemplateCreated, 1)
+}
+
+func (set *TemplateSet) templateCreated() bool {
+	return atomic.LoadInt32(&set.firstTemplateCreated) == 1
+}
+
 func (set *TemplateSet) AddLoader(loaders ...TemplateLoader) {
 	set.loaders = append(set.loaders, loaders...)
 }
@@ -97,11 +162,11 @@ func (set *TemplateSet) resolveFilenameForLoader(loader TemplateLoader, tpl *Tem
 
 // BanTag bans a specific tag for this template set. See more in the documentation for TemplateSet.
 func (set *TemplateSet) BanTag(name string) error {
-	_, has := tags[name]
+	_, has := set.getTag(name)
 	if !has {
 		return fmt.Errorf("tag '%s' not found", name)
 	}
-	if set.firstTemplateCreated {
+	if set.templateCreated() {
 		return errors.New("you cannot ban any tags after you've added your first template to your template set")
 	}
 	_, has = set.bannedTags[name]
@@ -115,11 +180,11 @@ func (set *TemplateSet) BanTag(name string) error {
 
 // BanFilter bans a specific filter for this template set. See more in the documentation for TemplateSet.
 func (set *TemplateSet) BanFilter(name string) error {
-	_, has := filters[name]
+	_, has := set.getFilter(name)
 	if !has {
 		return fmt.Errorf("filter '%s' not found", name)
 	}
-	if set.firstTemplateCreated {
+	if set.templateCreated() {
 		return errors.New("you cannot ban any filters after you've added your first template to your template set")
 	}
 	_, has = set.bannedFilters[name]
@@ -131,6 +196,165 @@ func (set *TemplateSet) BanFilter(name string) error {
 	return nil
 }
 
+// AllowTags switches the template set into allow-list mode for tags: only the given
+// tags (and the ones of further calls to AllowTags) can be used. Banned tags stay banned.
+// See more in the documentation for TemplateSet.
+func (set *TemplateSet) AllowTags(names ...string) error {
+	if set.templateCreated() {
+		return errors.New("you cannot allow any tags after you've added your first template to your template set")
+	}
+	for _, name := range names {
+		if _, has := set.getTag(name); !has {
+			return fmt.Errorf("tag '%s' not found", name)
+		}
+	}
+	if set.allowedTags == nil {
+		set.allowedTags = make(map[string]bool)
+	}
+	for _, name := range names {
+		set.allowedTags[name] = true
+	}
+
+	return nil
+}
+
+// AllowFilters switches the template set into allow-list mode for filters: only the given
+// filters (and the ones of further calls to AllowFilters) can be used. Banned filters stay banned.
+// See more in the documentation for TemplateSet.
+func (set *TemplateSet) AllowFilters(names ...string) error {
+	if set.templateCreated() {
+		return errors.New("you cannot allow any filters after you've added your first template to your template set")
+	}
+	for _, name := range names {
+		if _, has := set.getFilter(name); !has {
+			return fmt.Errorf("filter '%s' not found", name)
+		}
+	}
+	if set.allowedFilters == nil {
+		set.allowedFilters = make(map[string]bool)
+	}
+	for _, name := range names {
+		set.allowedFilters[name] = true
+	}
+
+	return nil
+}
+
+// RegisterTag registers a new tag which is only available to templates of this set.
+// It's not possible to override a global tag (see ReplaceTag for that) and
+// tags must be registered *before* you have added your first template to the set.
+func (set *TemplateSet) RegisterTag(name string, parserFn TagParser) error {
+	if set.templateCreated() {
+		return errors.New("you cannot register any tags after you've added your first template to your template set")
+	}
+	if _, existing := set.getTag(name); existing {
+		return fmt.Errorf("tag with name '%s' is already registered", name)
+	}
+	set.tags[name] = &tag{
+		name:   name,
+		parser: parserFn,
+	}
+	return nil
+}
+
+// RegisterFilter registers a new filter which is only available to templates of this set.
+// It's not possible to override a global filter (see ReplaceFilter for that) and
+// filters must be registered *before* you have added your first template to the set.
+func (set *TemplateSet) RegisterFilter(name string, fn FilterFunction) error {
+	if set.templateCreated() {
+		return errors.New("you cannot register any filters after you've added your first template to your template set")
+	}
+	if _, existing := set.getFilter(name); existing {
+		return fmt.Errorf("filter with name '%s' is already registered", name)
+	}
+	set.filters[name] = fn
+	return nil
+}
+
+// RegisterTest registers a new test which is only available to templates of this set.
+// It's not possible to override a global test (see ReplaceTest for that) and
+// tests must be registered *before* you have added your first template to the set.
+func (set *TemplateSet) RegisterTest(name string, fn TestFunction) error {
+	if set.templateCreated() {
+		return errors.New("you cannot register any tests after you've added your first template to your template set")
+	}
+	if _, existing := set.getTest(name); existing {
+		return fmt.Errorf("test with name '%s' is already registered", name)
+	}
+	set.tests[name] = fn
+	return nil
+}
+
+// RegisterEscaper registers a new escaping strategy which is only available to
+// templates of this set and which is used for templates of this set whose filenames
+// end with one of the given extensions (if TemplateSet.EscaperByExtension is set).
+// Escapers must be registered *before* you have added your first template to the set.
+func (set *TemplateSet) RegisterEscaper(name string, escaper Escaper, extensions ...string) error {
+	if set.templateCreated() {
+		return errors.New("you cannot register any escapers after you've added your first template to your template set")
+	}
+	if _, existing := set.getEscaper(name); existing {
+		return fmt.Errorf("escaper with name '%s' is already registered", name)
+	}
+	set.escapers[name] = escaper
+	for _, ext := range extensions {
+		set.escaperExtensions[strings.ToLower(ext)] = name
+	}
+	return nil
+}
+
+// getTag looks up a tag registered for this set or globally.
+func (set *TemplateSet) getTag(name string) (*tag, bool) {
+	if t, has := set.tags[name]; has {
+		return t, true
+	}
+	t, has := tags[name]
+	return t, has
+}
+
+// getFilter looks up a filter registered for this set or globally.
+func (set *TemplateSet) getFilter(name string) (FilterFunction, bool) {
+	if fn, has := set.filters[name]; has {
+		return fn, true
+	}
+	fn, has := filters[name]
+	return fn, has
+}
+
+// getTest looks up a test registered for this set or globally.
+func (set *TemplateSet) getTest(name string) (TestFunction, bool) {
+	if fn, has := set.tests[name]; has {
+		return fn, true
+	}
+	fn, has := tests[name]
+	return fn, has
+}
+
+// getEscaper looks up an escaping strategy registered for this set or globally.
+func (set *TemplateSet) getEscaper(name string) (Escaper, bool) {
+	if escaper, has := set.escapers[name]; has {
+		return escaper, true
+	}
+	escaper, has := escapers[name]
+	return escaper, has
+}
+
+// tagAllowed checks the tag against the set's sandbox restrictions.
+func (set *TemplateSet) tagAllowed(name string) bool {
+	if set.bannedTags[name] {
+		return false
+	}
+	return set.allowedTags == nil || set.allowedTags[name]
+}
+
+// filterAllowed checks the filter against the set's sandbox restrictions.
+func (set *TemplateSet) filterAllowed(name string) bool {
+	if set.bannedFilters[name] {
+		return false
+	}
+	return set.allowedFilters == nil || set.allowedFilters[name]
+}
+
 func (set *TemplateSet) resolveTemplate(tpl *Template, path string) (name string, loader TemplateLoader, fd io.Reader, err error) {
 	// iterate over loaders until we appear to have a valid template
 	for _, loader = range set.loaders {
@@ -141,22 +365,66 @@ func (set *TemplateSet) resolveTemplate(tpl *Template, path string) (name string
 		}
 	}
 
-	return path, nil, nil, fmt.Errorf("unable to resolve template")
+	return path, nil, nil, fmt.Errorf("unable to resolve template: %w", err)
 }
 
-// CleanCache cleans the template cache. If filenames is not empty,
-// it will remove the template caches of those filenames.
-// Or it will empty the whole template cache. It is thread-safe.
+// templateExists returns true if filename is in the reference cache or can be
+// found by one of the set's loaders. Loaders implementing ModTimeLoader are asked
+// for the modification time, so the template isn't read.
+func (set *TemplateSet) templateExists(filename string) bool {
+	if !set.Debug && !set.AutoReload {
+		set.referenceCacheMutex.Lock()
+		_, has := set.referenceCache[filename]
+		set.referenceCacheMutex.Unlock()
+		if has {
+			return true
+		}
+	}
+
+	for _, loader := range set.loaders {
+		name := set.resolveFilenameForLoader(loader, nil, filename)
+		if modTimeLoader, ok := loader.(ModTimeLoader); ok {
+			if _, err := modTimeLoader.ModTime(name); err == nil {
+				return true
+			}
+			continue
+		}
+		if _, err := loader.Get(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// CleanCache cleans the template cache (and the cache of imported templates
+// and dynamic parents). If filenames is not empty, it will remove the template
+// caches of those filenames and of all templates depending on them. Or it will
+// empty the whole template cache. It is thread-safe.
 func (set *TemplateSet) CleanCache(filenames ...string) {
 	set.templateCacheMutex.Lock()
 	defer set.templateCacheMutex.Unlock()
 
+	set.referenceCacheMutex.Lock()
+	defer set.referenceCacheMutex.Unlock()
+
 	if len(filenames) == 0 {
 		set.templateCache = make(map[string]*Template, len(set.templateCache))
+		set.referenceCache = make(map[string]*Template, len(set.referenceCache))
 	}
 
+	// Templates depending on one of the files are removed as well
 	for _, filename := range filenames {
-		delete(set.templateCache, set.resolveFilename(nil, filename))
+		filename = set.resolveFilename(nil, filename)
+		for name, tpl := range set.templateCache {
+			if tpl.dependsOn(filename) {
+				delete(set.templateCache, name)
+			}
+		}
+		for name, tpl := range set.referenceCache {
+			if tpl.dependsOn(filename) {
+				delete(set.referenceCache, name)
+			}
+		}
 	}
 }
 
@@ -178,8 +446,8 @@ func (set *TemplateSet) FromCache(filename string) (*Template, error) {
 
 	tpl, has := set.templateCache[cleanedFilename]
 
-	// Cache miss
-	if !has {
+	// Cache miss (or the cached template is stale)
+	if !has || (set.AutoReload && set.isStale(tpl)) {
 		tpl, err := set.FromFile(cleanedFilename)
 		if err != nil {
 			return nil, err
@@ -192,25 +460,63 @@ func (set *TemplateSet) FromCache(filename string) (*Template, error) {
 	return tpl, nil
 }
 
+// referencedTemplate returns the compiled template for an import (the import and
+// from tags) or a dynamic extends and caches it (unless TemplateSet.Debug is true).
+// The lock isn't held during compilation since the imported template may import
+// other templates itself.
+func (set *TemplateSet) referencedTemplate(filename string) (*Template, error) {
+	if set.Debug {
+		return set.FromFile(filename)
+	}
+
+	set.referenceCacheMutex.Lock()
+	tpl, has := set.referenceCache[filename]
+	set.referenceCacheMutex.Unlock()
+	if has && !(set.AutoReload && set.isStale(tpl)) {
+		return tpl, nil
+	}
+
+	tpl, err := set.FromFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	set.referenceCacheMutex.Lock()
+	set.referenceCache[filename] = tpl
+	set.referenceCacheMutex.Unlock()
+
+	return tpl, nil
+}
+
+// compileReference returns the compiled template for an include, a static extends
+// or a parsed ssi. Like FromFile, the template is compiled anew; only if AutoReload
+// is true (so changes are detected) it's taken from the set's reference cache.
+func (set *TemplateSet) compileReference(filename string) (*Template, error) {
+	if !set.AutoReload {
+		return set.FromFile(filename)
+	}
+	return set.referencedTemplate(filename)
+}
+
 // FromString loads a template from string and returns a Template instance.
 func (set *TemplateSet) FromString(tpl string) (*Template, error) {
-	set.firstTemplateCreated = true
+	set.markTemplateCreated()
 
 	return newTemplateString(set, []byte(tpl))
 }
 
 // FromBytes loads a template from bytes and returns a Template instance.
 func (set *TemplateSet) FromBytes(tpl []byte) (*Template, error) {
-	set.firstTemplateCreated = true
+	set.markTemplateCreated()
 
 	return newTemplateString(set, tpl)
 }
 
 // FromFile loads a template from a filename and returns a Template instance.
 func (set *TemplateSet) FromFile(filename string) (*Template, error) {
-	set.firstTemplateCreated = true
+	set.markTemplateCreated()
 
-	_, _, fd, err := set.resolveTemplate(nil, filename)
+	_, buf, fingerprint, err := set.loadSource(nil, filename)
 	if err != nil {
 		return nil, &Error{
 			Filename:  filename,
@@ -218,21 +524,18 @@ func (set *TemplateSet) FromFile(filename string) (*Template, error) {
 			OrigError: err,
 		}
 	}
-	buf, err := io.ReadAll(fd)
+
+	tpl, err := newTemplate(set, filename, false, buf)
 	if err != nil {
-		return nil, &Error{
-			Filename:  filename,
-			Sender:    "fromfile",
-			OrigError: err,
-		}
+		return nil, err
 	}
-
-	return newTemplate(set, filename, false, buf)
+	tpl.fingerprint = fingerprint
+	return tpl, nil
 }
 
 // RenderTemplateString is a shortcut and renders a template string directly.
 func (set *TemplateSet) RenderTemplateString(s string, ctx Context) (string, error) {
-	set.firstTemplateCreated = true
+	set.markTemplateCreated()
 
 	tpl := Must(set.FromString(s))
 	result, err := tpl.Execute(ctx)
@@ -244,7 +547,7 @@ func (set *TemplateSet) RenderTemplateString(s string, ctx Context) (string, err
 
 // RenderTemplateBytes is a shortcut and renders template bytes directly.
 func (set *TemplateSet) RenderTemplateBytes(b []byte, ctx Context) (string, error) {
-	set.firstTemplateCreated = true
+	set.markTemplateCreated()
 
 	tpl := Must(set.FromBytes(b))
 	result, err := tpl.Execute(ctx)
@@ -256,7 +559,7 @@ func (set *TemplateSet) RenderTemplateBytes(b []byte, ctx Context) (string, erro
 
 // RenderTemplateFile is a shortcut and renders a template file directly.
 func (set *TemplateSet) RenderTemplateFile(fn string, ctx Context) (string, error) {
-	set.firstTemplateCreated = true
+	set.markTemplateCreated()
 
 	tpl := Must(set.FromFile(fn))
 	result, err := tpl.Execute(ctx)
@@ -266,6 +569,17 @@ func (set *TemplateSet) RenderTemplateFile(fn string, ctx Context) (string, erro
 	return result, nil
 }
 
+// ExecuteContext is a shortcut and renders a template file (loaded through
+// FromCache) to w, aborting the execution as soon as ctx is done.
+// See Template.ExecuteContext for more details.
+func (set *TemplateSet) ExecuteContext(ctx context.Context, filename string, data Context, w io.Writer) error {
+	tpl, err := set.FromCache(filename)
+	if err != nil {
+		return err
+	}
+	return tpl.ExecuteContext(ctx, data, w)
+}
+
 func (set *TemplateSet) logf(format string, args ...any) {
 	if set.Debug {
 		logger.Printf(fmt.Sprintf("[template set: %s] %s", set.name, format), args...)
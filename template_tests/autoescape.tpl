@@ -7,4 +7,14 @@
 {% endautoescape %}
 {% autoescape off %}
 {{ "<script>alert('xss');</script>"|escape }}
-{% endautoescape %}
\ No newline at end of file
+{% endautoescape %}
+{% autoescape latex %}
+{{ "50% of $x_1 & {y}" }} {{ "\\emph{safe}"|safe }}
+{% endautoescape %}
+{% autoescape yaml %}
+name: {{ "Tom: \"the cat\"" }}
+{% endautoescape %}
+{% autoescape text %}
+{{ "<b>plain</b>" }}
+{% endautoescape %}
+{% autoescape latex %}{% autoescape off %}{{ "100%" }}{% endautoescape %} {{ "100%" }}{% endautoescape %}
\ No newline at end of file
@@ -0,0 +1,10 @@
+{{ "yes" if true else "no" }} {{ "yes" if false else "no" }} {{ "yes" if 0 }}|
+{{ simple.name if simple.number > 10 else "small" }}
+{{ "a" if false else "b" if false else "c" }}
+{{ 1 + 2 if simple.bool_true and simple.number else 0 }}
+<div class="{{ "active" if simple.bool_true else "inactive" }}"></div>
+{{ simple.nothing|default:("x" if simple.bool_true else "y") }}
+{% set cls = "even" if simple.number % 2 == 0 else "odd" %}{{ cls }}
+{{ "<b>" if true else "<i>" }} {{ "<b>"|safe if true else "<i>"|safe }}
+{{ "ok" if true else simple.func_add(1) }}
+{{ simple.func_add(1) if false else "lazy" }}
@@ -0,0 +1,7 @@
+{% set opts = {"title": "Hello", size: 1 + 2, "nested": {"list": [1, 2, 3]}, name: simple.name} %}{{ opts.title }} {{ opts["size"] }} {{ opts.nested.list.1 }} {{ opts.name }}
+{{ opts|length }} {{ {}|length }}
+{% for key, value in {b: 2, a: 1, c: 3} sorted %}{{ key }}={{ value }} {% endfor %}
+{% macro card(options) %}<{{ options.tag|default:"div" }}>{{ options.title }}</{{ options.tag|default:"div" }}>{% endmacro %}{{ card({title: "Card", tag: "section"}) }} {{ card({"title": "Card"}) }}
+{% with d={"x": "<b>"} %}{{ d.x }}{% endwith %}
+
+{% with d={"a": {"b": 2}}%}{{ d.a.b }}{% endwith %} {{ {"a": {"b": 1}}|length}} {{ "a" in {"a": 1}}}
\ No newline at end of file
@@ -0,0 +1,3 @@
+{% extends "inheritance/base.tpl" if simple.bool_true else "inheritance/missing.tpl" %}
+
+{% block content %}Dynamic content{% endblock %}
\ No newline at end of file
@@ -0,0 +1,3 @@
+{% extends ["inheritance/missing.tpl", "inheritance/base.tpl"] %}
+
+{% block content %}{{ block.Super }} with fallback{% endblock %}
\ No newline at end of file
@@ -0,0 +1,15 @@
+break/continue
+{% for item in simple.multiple_item_list %}{% if item == 8 %}{% break %}{% endif %}{{ item }} {% endfor %}
+{% for item in simple.multiple_item_list %}{% if item is odd %}{% continue %}{% endif %}{{ item }} {% endfor %}
+{% for item in simple.multiple_item_list %}{% if item > 3 %}{% break %}{% else %}{% continue %}{% endif %}never{% endfor %}done
+nested
+{% for i in simple.misc_list %}{{ i }}:{% for j in simple.multiple_item_list %}{% if j > 2 %}{% break %}{% endif %}{{ j }}{% endfor %} {% if forloop.Counter == 2 %}{% break %}{% endif %}{% endfor %}
+{% for item in [] %}{% empty %}{% for x in [1, 2, 3] %}{{ x }}{% break %}{% endfor %}{% endfor %}
+included
+{% for item in simple.multiple_item_list %}{% include "for_control.helper" %}{% endfor %}
+filtered
+{% for item in simple.multiple_item_list if item is odd %}{{ forloop.Counter }}/{{ forloop.Revcounter }}={{ item }}{% if forloop.First %} first{% endif %}{% if forloop.Last %} last{% endif %}
+{% endfor %}{% for key, value in simple.strmap sorted if key != "abc" and value != "cde" %}{{ key }}={{ value }} {% endfor %}
+{% for item in simple.multiple_item_list reversed if item > 10 %}{{ item }} {% if item == 21 %}{% break %}{% endif %}{% endfor %}
+{% for item in simple.multiple_item_list if item > 100 %}{{ item }}{% empty %}nothing above 100{% endfor %} {% for item in simple.multiple_item_list if item > 100 %}{{ item }}{% else %}(else){% endfor %}
+{% for item in simple.multiple_item_list if item > 10 %}{{ "big" if item > 30 else "medium" }} {% endfor %}
@@ -0,0 +1,11 @@
+{% for item in simple.misc_list %}{{ forloop.Counter }}/{{ forloop.Length }} depth={{ forloop.Depth }}/{{ forloop.Depth0 }} prev={{ forloop.PrevItem|default:"-" }} next={{ forloop.NextItem|default:"-" }}
+{% endfor %}
+{% for item in simple.multiple_item_list %}<tr class="{{ forloop.Cycle("odd", "even") }}">{{ item }}</tr>{% endfor %}
+{% for i in simple.one_item_list %}{% for j in simple.fixed_item_list %}{{ forloop.Depth }}{{ forloop.Parentloop.Depth }}{{ forloop.Cycle("a", "b", "c") }} {% endfor %}{% endfor %}
+{% for item in simple.multiple_item_list %}{% if forloop.Changed(item is odd) %}[{{ "odd" if item is odd else "even" }}] {% endif %}{{ item }} {% endfor %}
+{% for item in simple.multiple_item_list %}{% if forloop.Changed(item > 5, item > 20) %}|{% endif %}{{ item }}{% endfor %}
+{% for item in simple.multiple_item_list if item is odd %}{{ forloop.PrevItem|default:"-" }}<{{ item }}>{{ forloop.NextItem|default:"-" }}/{{ forloop.Length }} {% endfor %}
+{% for item in simple.multiple_item_list %}{% if item > 3 %}{% break %}{% endif %}{{ item }}->{{ forloop.NextItem }} {% endfor %}
+{% for key, value in {b: 2, a: 1, c: 3} sorted %}{{ forloop.PrevItem|default:"-" }}<{{ key }}={{ value }}>{{ forloop.NextItem|default:"-" }} {% endfor %}
+{% set ns = namespace(go=true) %}{% for i in simple.multiple_item_list if ns.go %}{{ i }} {% if i == 2 %}{% set ns.go = false %}{% endif %}{% endfor %}
+{% set ns = namespace(go=true) %}{% for i in simple.multiple_item_list if ns.go %}{{ i }}{% if forloop.Last %}.{% endif %} {% if i == 2 %}{% set ns.go = false %}{% endif %}{% endfor %}
@@ -13,4 +13,9 @@ eqnil: {{ simple.func_ensure_nil(nil) }}
 neqnil: {{ simple.func_ensure_nil(1) }}
 v1: {{ simple.func_ensure_nil_variadic(nil) }}
 v2: {{ simple.func_ensure_nil_variadic() }}
-v3: {{ simple.func_ensure_nil_variadic(nil, 1, nil, "test") }}
\ No newline at end of file
+v3: {{ simple.func_ensure_nil_variadic(nil, 1, nil, "test") }}
+kw1: {{ simple.func_kwargs("button") }}
+kw2: {{ simple.func_kwargs("button", size=3) }}
+kw3: {{ simple.func_kwargs("button", size=simple.number, color="red") }}
+kw4: {{ simple.func_kwargs_variadic() }}
+kw5: {{ simple.func_kwargs_variadic(1, 2, a=1) }}
@@ -0,0 +1,6 @@
+{% import "macro.helper" as helpers %}{{ helpers.imported_macro("User1") }}
+{{ helpers.imported_macro_void() }}
+{{ helpers.imported_macro(foo="keyword") }}
+{% if helpers is mapping %}namespace{% endif %}
+{% from "macro.helper" import * %}{{ imported_macro("User2") }} {{ imported_macro_void() }}
+{% from "macro.helper" import imported_macro as im, imported_macro_void %}{{ im("User3") }} {{ imported_macro_void() }}
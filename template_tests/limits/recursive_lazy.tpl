@@ -0,0 +1 @@
+{% include name %}
\ No newline at end of file
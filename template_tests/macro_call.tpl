@@ -0,0 +1,10 @@
+{% macro card(title) %}<div class="card"><h1>{{ title }}</h1>{{ caller() }}</div>{% endmacro %}
+{% call card("Hello") %}<p>Body of {{ simple.name }}</p>{% endcall %}
+{% macro list_items(items) %}<ul>{% for item in items %}<li>{{ caller(item, forloop.Counter) }}</li>{% endfor %}</ul>{% endmacro %}
+{% call(item, n) list_items(simple.misc_list) %}{{ n }}: {{ item }}{% endcall %}
+{% macro maybe_caller() %}{% if caller is defined %}[{{ caller() }}]{% else %}no caller{% endif %}{% endmacro %}
+{{ maybe_caller() }} {% call maybe_caller() %}with caller{% endcall %}
+{% macro outer() %}<outer>{% call card("inner") %}{{ caller() }}{% endcall %}</outer>{% endmacro %}
+{% call outer() %}nested {{ simple.xss }}{% endcall %}
+{% call card("twice") %}{% for i in simple.one_item_list %}{{ i }}{% endfor %}{% endcall %}
+{% macro bold(s) %}<b>{{ s }}</b>{% endmacro %}{% macro pass() %}{{ caller(bold("safe"), "<i>unsafe</i>") }}{% endmacro %}{% call(a, b) pass() %}{{ a }} {{ b }}{% endcall %}
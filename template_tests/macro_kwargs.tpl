@@ -0,0 +1,12 @@
+{% macro button(label, size=2, style="plain") %}<button class="{{ style }}-{{ size }}">{{ label }}</button>{% endmacro %}
+{{ button("Save") }}
+{{ button("Save", style="primary") }}
+{{ button(label="Delete", size=3) }}
+{{ button("Edit", 1, style=simple.name) }}
+{% macro tag(name) %}<{{ name }}{% for key, value in kwargs sorted %} {{ key }}="{{ value }}"{% endfor %}>{{ varargs|join:", " }}</{{ name }}>{% endmacro %}
+{{ tag("p") }}
+{{ tag("p", "a", "b", id="main", class="x") }}
+{% macro count() %}{{ varargs|length }} {{ kwargs|length }}{% endmacro %}{{ count() }} {{ count(1, 2, 3, x=1) }}
+{% macro card(title) %}<div>{{ title }}: {{ caller() }}</div>{% endmacro %}
+{% call card(title="kw") %}body{% endcall %}
+{% macro m() %}{% if false %}{% elif varargs %}{{ varargs|length }}{% endif %}{% endmacro %}{{ m(1, 2) }}
@@ -0,0 +1,8 @@
+{% set greeting %}Hello {{ simple.name }}!{% endset %}[{{ greeting }}] [{{ greeting|upper }}] {{ greeting|length }}
+{% set html %}<b>{{ simple.xss }}</b>{% endset %}{{ html }}
+{% set ns = namespace(count=0, found=false, last="") %}{% for item in simple.misc_list %}{% set ns.count = ns.count + 1 %}{% set ns.last = item %}{% if item == 99 %}{% set ns.found = true %}{% endif %}{% endfor %}{{ ns.count }} {{ ns.found }} {{ ns.last }}
+{% set scoped = "outer" %}{% for item in simple.misc_list %}{% set scoped = item %}{% endfor %}{{ scoped }}
+{% set ns.captured %}{% for item in simple.misc_list %}{{ item }},{% endfor %}{% endset %}{{ ns.captured }}
+{% with local="inner" %}{% set scoped = local %}{% set ns.from_with = local %}{% endwith %}{{ scoped }} {{ ns.from_with }}
+{% if true %}{% set from_if = "if opens no scope" %}{% endif %}{{ from_if }}
+{% macro counter(ns) %}{% set ns.count = ns.count + 10 %}{% endmacro %}{{ counter(ns) }}{{ ns.count }}
@@ -0,0 +1,21 @@
+defined/undefined
+{{ simple.name is defined }} {{ simple.nil is defined }} {{ simple.missing is defined }} {{ missing is defined }} {{ missing.deeper is defined }}
+{{ simple.missing is undefined }} {{ simple.name is undefined }} {{ simple.misc_list.10 is undefined }}
+{% if not missing is defined %}missing is not defined{% endif %} {% if missing is not defined %}same{% endif %}
+{{ simple.missing|default:"fallback" }} {{ "set" if simple.name is defined else "unset" }}
+
+none
+{{ simple.nil is none }} {{ simple.missing is none }} {{ simple.name is none }} {{ simple.name is not none }}
+
+types
+{{ simple.number is number }} {{ simple.float is number }} {{ simple.name is number }} {{ simple.name is string }} {{ simple.number is string }}
+{{ simple.strmap is mapping }} {{ simple.misc_list is mapping }} {{ {"a": 1} is mapping }}
+{{ simple.misc_list is iterable }} {{ simple.strmap is iterable }} {{ simple.name is iterable }} {{ simple.number is iterable }}
+
+numbers
+{{ simple.number is even }} {{ simple.number is odd }} {{ number is odd }} {{ simple.float is even }}
+{{ simple.number is divisibleby 7 }} {{ simple.number is divisibleby(5) }} {{ simple.number is not divisibleby 5 }} {{ simple.number is divisibleby 0 }}
+{% for i in simple.multiple_item_list %}{% if i is even %}{{ i }} {% endif %}{% endfor %}
+
+sameas
+{{ simple.strmap is sameas simple.strmap }} {{ simple.strmap is sameas simple.intmap }} {{ simple.nil is sameas nothing }} {{ simple.number is sameas 42 }}
@@ -0,0 +1,147 @@
+package pongo2
+
+import (
+	"fmt"
+)
+
+// TestFunction is the type test functions must fulfil. Tests are used with
+// the `is` operator, e. g. `{% if number is divisibleby 3 %}`. The param
+// is nil (AsValue(nil)) if no argument was given.
+type TestFunction func(in *Value, param *Value) (bool, *Error)
+
+var tests map[string]TestFunction
+
+func init() {
+	tests = make(map[string]TestFunction)
+}
+
+// TestExists returns true if the given test is already registered
+func TestExists(name string) bool {
+	_, existing := tests[name]
+	return existing
+}
+
+// RegisterTest registers a new test. If there's already a test with the same
+// name, RegisterTest will return an error. You usually want to call this
+// function in the test's init() function:
+//
+//	http://golang.org/doc/effective_go.html#init
+func RegisterTest(name string, fn TestFunction) error {
+	if TestExists(name) {
+		return fmt.Errorf("test with name '%s' is already registered", name)
+	}
+	tests[name] = fn
+	return nil
+}
+
+// ReplaceTest replaces an already registered test with a new implementation. Use this
+// function with caution since it allows you to change existing test behaviour.
+func ReplaceTest(name string, fn TestFunction) error {
+	if !TestExists(name) {
+		return fmt.Errorf("test with name '%s' does not exist (therefore cannot be overridden)", name)
+	}
+	tests[name] = fn
+	return nil
+}
+
+type testExpression struct {
+	expr      IEvaluator
+	token     *Token
+	name      string
+	negate    bool
+	parameter IEvaluator
+	testFunc  TestFunction
+}
+
+func (expr *testExpression) FilterApplied(name string) bool {
+	return false
+}
+
+func (expr *testExpression) GetPositionToken() *Token {
+	return expr.expr.GetPositionToken()
+}
+
+func (expr *testExpression) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	value, err := expr.Evaluate(ctx)
+	if err != nil {
+		return err
+	}
+	writer.WriteAny(value)
+	return nil
+}
+
+func (expr *testExpression) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
+	if err := ctx.countEvaluation(expr.token); err != nil {
+		return nil, err
+	}
+
+	v, err := expr.expr.Evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	param := AsValue(nil)
+	if expr.parameter != nil {
+		param, err = expr.parameter.Evaluate(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := expr.testFunc(v, param)
+	if err != nil {
+		return nil, err.updateFromTokenIfNeeded(ctx.template, expr.token)
+	}
+	return AsValue(result != expr.negate), nil
+}
+
+// Test = expr "is" ["not"] IDENT [ "(" expr ")" | TestArg ]
+func (p *Parser) parseTest(expr IEvaluator) (IEvaluator, *Error) {
+	test := &testExpression{
+		expr: expr,
+	}
+
+	if p.Match(TokenKeyword, "not") != nil {
+		test.negate = true
+	}
+
+	identToken := p.MatchType(TokenIdentifier)
+	if identToken == nil {
+		return nil, p.Error("Test name must be an identifier.", nil)
+	}
+	test.token = identToken
+	test.name = identToken.Val
+
+	testFn, exists := p.template.set.getTest(identToken.Val)
+	if !exists {
+		return nil, p.Error(fmt.Sprintf("Test '%s' does not exist.", identToken.Val), identToken)
+	}
+	test.testFunc = testFn
+
+	if test.name == "defined" || test.name == "undefined" {
+		// These tests must work regardless of the undefined policy
+		allowUndefined(expr)
+	}
+
+	// Check for an optional test argument, either in brackets or
+	// as a single literal/variable (e. g. `is divisibleby 3`)
+	if p.Match(TokenSymbol, "(") != nil {
+		param, err := p.ParseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if p.Match(TokenSymbol, ")") == nil {
+			return nil, p.Error("Closing bracket expected after test argument.", nil)
+		}
+		test.parameter = param
+	} else if t := p.Current(); t != nil && (t.Typ == TokenNumber || t.Typ == TokenString ||
+		(t.Typ == TokenIdentifier && t.Val != "if" && t.Val != "else")) {
+		param, err := p.parseVariableOrLiteralWithFilter()
+		if err != nil {
+			return nil, err
+		}
+		test.parameter = param
+	}
+
+	return test, nil
+}
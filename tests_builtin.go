@@ -0,0 +1,104 @@
+package pongo2
+
+import (
+	"reflect"
+)
+
+func init() {
+	RegisterTest("defined", testDefined)
+	RegisterTest("undefined", testUndefined)
+	RegisterTest("none", testNone)
+	RegisterTest("number", testNumber)
+	RegisterTest("string", testString)
+	RegisterTest("mapping", testMapping)
+	RegisterTest("iterable", testIterable)
+	RegisterTest("even", testEven)
+	RegisterTest("odd", testOdd)
+	RegisterTest("divisibleby", testDivisibleby)
+	RegisterTest("sameas", testSameas)
+}
+
+// rawValue returns the underlying value without dereferencing any pointers.
+func rawValue(v *Value) any {
+	for {
+		inner, ok := v.val.(*Value)
+		if !ok {
+			return v.val
+		}
+		v = inner
+	}
+}
+
+func testDefined(in *Value, param *Value) (bool, *Error) {
+	return !in.isUndefined(), nil
+}
+
+func testUndefined(in *Value, param *Value) (bool, *Error) {
+	return in.isUndefined(), nil
+}
+
+func testNone(in *Value, param *Value) (bool, *Error) {
+	return !in.isUndefined() && in.getResolvedValue() == nil, nil
+}
+
+func testNumber(in *Value, param *Value) (bool, *Error) {
+	return in.IsNumber(), nil
+}
+
+func testString(in *Value, param *Value) (bool, *Error) {
+	return in.IsString(), nil
+}
+
+func testMapping(in *Value, param *Value) (bool, *Error) {
+	val := in.getResolvedValue()
+	return val != nil && reflect.ValueOf(val).Kind() == reflect.Map, nil
+}
+
+func testIterable(in *Value, param *Value) (bool, *Error) {
+	val := in.getResolvedValue()
+	if val == nil {
+		return false, nil
+	}
+	switch reflect.ValueOf(val).Kind() {
+	case reflect.String, reflect.Array, reflect.Slice, reflect.Map:
+		return true, nil
+	}
+	return false, nil
+}
+
+func testEven(in *Value, param *Value) (bool, *Error) {
+	return in.IsInteger() && in.Integer()%2 == 0, nil
+}
+
+func testOdd(in *Value, param *Value) (bool, *Error) {
+	return in.IsInteger() && in.Integer()%2 != 0, nil
+}
+
+func testDivisibleby(in *Value, param *Value) (bool, *Error) {
+	if param.Integer() == 0 {
+		return false, nil
+	}
+	return in.Integer()%param.Integer() == 0, nil
+}
+
+func testSameas(in *Value, param *Value) (bool, *Error) {
+	a, b := rawValue(in), rawValue(param)
+	if a == nil || b == nil {
+		return a == nil && b == nil, nil
+	}
+
+	ra, rb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if ra.Type() != rb.Type() {
+		return false, nil
+	}
+	switch ra.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return ra.Pointer() == rb.Pointer(), nil
+	case reflect.Slice:
+		return ra.Pointer() == rb.Pointer() && ra.Len() == rb.Len(), nil
+	}
+	if ra.Type().Comparable() {
+		return a == b, nil
+	}
+	return false, nil
+}
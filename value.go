@@ -1,6 +1,7 @@
 package pongo2
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"sort"
@@ -11,8 +12,9 @@ import (
 )
 
 type Value struct {
-	val  any
-	safe bool // used to indicate whether a Value needs explicit escaping in the template
+	val       any
+	safe      bool // used to indicate whether a Value needs explicit escaping in the template
+	undefined bool // used to indicate that the Value results from a variable which doesn't exist
 }
 
 var valuePool = sync.Pool{
@@ -33,6 +35,7 @@ func acquireValue(val any, safe bool) *Value {
 func releaseValue(v *Value) {
 	v.val = nil
 	v.safe = false
+	v.undefined = false
 	valuePool.Put(v)
 }
 
@@ -57,6 +60,13 @@ func AsSafeValue(i any) *Value {
 	}
 }
 
+// undefinedValue returns the nil Value of a variable which couldn't be resolved.
+func undefinedValue() *Value {
+	return &Value{
+		undefined: true,
+	}
+}
+
 func (v *Value) getResolvedValue() any {
 	// Dereference pointer if needed
 	if v.val == nil {
@@ -65,6 +75,8 @@ func (v *Value) getResolvedValue() any {
 
 	// Handle common pointer types directly without reflection
 	switch val := v.val.(type) {
+	case *Value:
+		return val.getResolvedValue()
 	case *string:
 		return *val
 	case *int:
@@ -111,13 +123,56 @@ func (v *Value) getResolvedValue() any {
 	return v.val
 }
 
-// IsString checks whether the underlying value is a string
+// IsString checks whether the underlying value is a string. Values of
+// html/template's safe types (such as template.HTML) and string types
+// implementing SafeString are strings as well.
 func (v *Value) IsString() bool {
-	val := v.getResolvedValue()
-	_, ok := val.(string)
+	_, ok := v.stringContent()
 	return ok
 }
 
+// isSafe checks whether the value has been marked as safe (using AsSafeValue or
+// the safe filter) or implements SafeString.
+func (v *Value) isSafe() bool {
+	if v.safe {
+		return true
+	}
+	if _, ok := v.val.(SafeString); ok {
+		return true
+	}
+	_, ok := v.getResolvedValue().(SafeString)
+	return ok
+}
+
+// htmlContent returns the content and the type of a value of one of html/template's
+// safe types (such as template.HTML).
+func (v *Value) htmlContent() (string, contentType) {
+	return htmlContent(v.getResolvedValue())
+}
+
+// stringContent returns the underlying value as a string if it's a string, a
+// value of one of html/template's safe types or of a string type implementing
+// SafeString.
+func (v *Value) stringContent() (string, bool) {
+	val := v.getResolvedValue()
+	if str, ok := val.(string); ok {
+		return str, true
+	}
+	if str, typ := htmlContent(val); typ != contentPlain {
+		return str, true
+	}
+	if val != nil && reflect.TypeOf(val).Kind() == reflect.String {
+		// SafeString might be defined on the pointer receiver
+		if str, ok := safeString(v.val); ok {
+			return str, true
+		}
+		if str, ok := safeString(val); ok {
+			return str, true
+		}
+	}
+	return "", false
+}
+
 // IsBool checks whether the underlying value is a bool
 func (v *Value) IsBool() bool {
 	val := v.getResolvedValue()
@@ -162,6 +217,14 @@ func (v *Value) IsNil() bool {
 	return v.val == nil
 }
 
+// isUndefined checks whether the value results from a variable which doesn't exist
+func (v *Value) isUndefined() bool {
+	if inner, ok := v.val.(*Value); ok {
+		return inner.isUndefined()
+	}
+	return v.undefined
+}
+
 // String returns a string for the underlying value. If this value is not
 // of type string, pongo2 tries to convert it. Currently the following
 // types for underlying values are supported:
@@ -180,11 +243,25 @@ func (v *Value) String() string {
 		return ""
 	}
 
+	// SafeString and Stringer methods might be defined on the pointer receiver
+	if s, ok := safeString(v.val); ok {
+		return s
+	}
+	if t, ok := v.val.(fmt.Stringer); ok {
+		return t.String()
+	}
+
 	val := v.getResolvedValue()
 
+	if s, ok := safeString(val); ok {
+		return s
+	}
 	if t, ok := val.(fmt.Stringer); ok {
 		return t.String()
 	}
+	if s, typ := htmlContent(val); typ != contentPlain {
+		return s
+	}
 
 	switch val := val.(type) {
 	case string:
@@ -221,7 +298,7 @@ func (v *Value) String() string {
 	}
 
 	logf("Value.String() not implemented for type: %T\n", val)
-	return fmt.Sprintf("%v", val)
+	return fmt.Sprintf("<%T Value>", val)
 }
 
 // Integer returns the underlying value as an integer (converts the underlying
@@ -382,6 +459,10 @@ func (v *Value) IsTrue() bool {
 	case string:
 		return len(val) > 0
 	default:
+		if str, ok := v.stringContent(); ok {
+			return len(str) > 0
+		}
+
 		// For complex types, use reflection
 		rv := reflect.ValueOf(val)
 		switch rv.Kind() {
@@ -425,6 +506,10 @@ func (v *Value) Negate() *Value {
 	case string:
 		return AsValue(len(val) == 0)
 	default:
+		if str, ok := v.stringContent(); ok {
+			return AsValue(len(str) == 0)
+		}
+
 		// For complex types, use reflection
 		rv := reflect.ValueOf(val)
 		switch rv.Kind() {
@@ -447,7 +532,7 @@ func (v *Value) Len() int {
 		return 0
 	}
 
-	if str, ok := val.(string); ok {
+	if str, ok := v.stringContent(); ok {
 		return len([]rune(str))
 	}
 
@@ -470,7 +555,7 @@ func (v *Value) Slice(i, j int) *Value {
 		return AsValue([]int{})
 	}
 
-	if str, ok := val.(string); ok {
+	if str, ok := v.stringContent(); ok {
 		runes := []rune(str)
 		return AsValue(string(runes[i:j]))
 	}
@@ -494,7 +579,7 @@ func (v *Value) Index(i int) *Value {
 		return AsValue(nil)
 	}
 
-	if str, ok := val.(string); ok {
+	if str, ok := v.stringContent(); ok {
 		runes := []rune(str)
 		if i < len(runes) {
 			return AsValue(string(runes[i]))
@@ -530,7 +615,7 @@ func (v *Value) Contains(other *Value) bool {
 	}
 
 	// Handle string case directly
-	if str, ok := baseValue.(string); ok {
+	if str, ok := v.stringContent(); ok {
 		return strings.Contains(str, other.String())
 	}
 
@@ -579,7 +664,7 @@ func (v *Value) CanSlice() bool {
 		return false
 	}
 
-	if _, ok := val.(string); ok {
+	if _, ok := v.stringContent(); ok {
 		return true
 	}
 
@@ -616,7 +701,7 @@ func (v *Value) IterateOrder(fn func(idx, count int, key, value *Value) bool, em
 	}
 
 	// Handle string case directly
-	if str, ok := val.(string); ok {
+	if str, ok := v.stringContent(); ok {
 		rs := []rune(str)
 		charCount := len(rs)
 
@@ -770,6 +855,12 @@ func (v *Value) Interface() any {
 	return v.val
 }
 
+// MarshalJSON encodes the underlying value, so values nested in maps or slices
+// (such as keyword arguments) can be encoded as JSON.
+func (v *Value) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Interface())
+}
+
 // EqualValueTo checks whether two values are containing the same value or object (if comparable).
 func (v *Value) EqualValueTo(other *Value) bool {
 	// comparison of uint with int fails using .Interface()-comparison (see issue #64)
@@ -798,8 +889,8 @@ func (sk sortedKeys) Len() int {
 }
 
 func (sk sortedKeys) Less(i, j int) bool {
-	vi := &Value{val: sk[i]}
-	vj := &Value{val: sk[j]}
+	vi := &Value{val: sk[i].Interface()}
+	vj := &Value{val: sk[j].Interface()}
 	switch {
 	case vi.IsInteger() && vj.IsInteger():
 		return vi.Integer() < vj.Integer()
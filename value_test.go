@@ -0,0 +1,63 @@
+package pongo2
+
+import "testing"
+
+type pointerStringer struct{ name string }
+
+func (s *pointerStringer) String() string {
+	return "stringer " + s.name
+}
+
+type unprintable struct{ a, b int }
+
+func (u unprintable) Sum() int {
+	return u.a + u.b
+}
+
+func TestValueResolution(t *testing.T) {
+	// Stringers with pointer receivers and types without a string representation
+	if s := AsValue(&pointerStringer{"x"}).String(); s != "stringer x" {
+		t.Errorf("expected the pointer receiver's String(), got %q", s)
+	}
+	if s := AsValue(unprintable{1, 2}).String(); s != "<pongo2.unprintable Value>" {
+		t.Errorf("expected the type name, got %q", s)
+	}
+
+	// Values wrapping values
+	if i := AsValue(AsValue(42)).Integer(); i != 42 {
+		t.Errorf("expected the wrapped value, got %d", i)
+	}
+
+	// Sorted map keys are compared by their values
+	var keys []string
+	AsValue(map[int]string{10: "c", 2: "b", 1: "a"}).IterateOrder(func(idx, count int, key, value *Value) bool {
+		keys = append(keys, key.String())
+		return true
+	}, func() {}, false, true)
+	if len(keys) != 3 || keys[0] != "1" || keys[1] != "2" || keys[2] != "10" {
+		t.Errorf("expected sorted keys, got %v", keys)
+	}
+
+	ctx := Context{
+		"obj":  unprintable{1, 2},
+		"dict": map[string]any{"nothing": nil},
+	}
+	tests := map[string]string{
+		`{{ [1, "two", 3]|join:"," }}`:   "1,two,3",
+		`{{ obj.Sum }}`:                  "3",
+		`{{ dict.nothing|default:"-" }}`: "-",
+	}
+	for tc, expected := range tests {
+		tpl, err := FromString(tc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", tc, err)
+		}
+		if out != expected {
+			t.Errorf("%s: expected %q, got %q", tc, expected, out)
+		}
+	}
+}
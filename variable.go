@@ -8,6 +8,10 @@ import (
 	"strings"
 )
 
+// ErrUndefinedVariable is wrapped by the error returned for an undefined
+// variable if Options.Undefined is set to UndefinedError.
+var ErrUndefinedVariable = errors.New("undefined variable")
+
 const (
 	varTypeInt = iota
 	varTypeIdent
@@ -19,8 +23,19 @@ const (
 var (
 	typeOfValuePtr   = reflect.TypeOf(new(Value))
 	typeOfExecCtxPtr = reflect.TypeOf(new(ExecutionContext))
+	typeOfKwargs     = reflect.TypeOf(Kwargs(nil))
 )
 
+// Kwargs holds the keyword arguments of a function call, e. g.
+// {{ button(title="Save", size=3) }}. A function receives them by
+// accepting a parameter of type Kwargs (which mustn't be the variadic one):
+//
+//	func(label *pongo2.Value, kwargs pongo2.Kwargs) string
+//
+// The function receives an empty Kwargs if no keyword arguments are given.
+// Functions without such a parameter can't be called with keyword arguments.
+type Kwargs map[string]*Value
+
 type variablePart struct {
 	typ       int
 	s         string
@@ -30,6 +45,7 @@ type variablePart struct {
 
 	isFunctionCall bool
 	callingArgs    []functionCallArgument // needed for a function call, represents all argument nodes (INode supports nested function calls)
+	callingKwargs  []*keywordArgument     // keyword arguments of a function call (name=expr)
 }
 
 func (p *variablePart) String() string {
@@ -51,6 +67,14 @@ type functionCallArgument interface {
 	Evaluate(*ExecutionContext) (*Value, *Error)
 }
 
+type keywordArgument struct {
+	name string
+	expr IEvaluator
+}
+
+// kwargsEval evaluates the keyword arguments of a function call into a Kwargs.
+type kwargsEval []*keywordArgument
+
 // TODO: Add location tokens
 type stringResolver struct {
 	locationToken *Token
@@ -72,10 +96,19 @@ type boolResolver struct {
 	val           bool
 }
 
+type dictResolver struct {
+	locationToken *Token
+	keys          []string
+	values        []IEvaluator
+}
+
 type variableResolver struct {
 	locationToken *Token
 
 	parts []*variablePart
+
+	// allowUndefined exempts the variable from the undefined policy
+	allowUndefined bool
 }
 
 type nodeFilteredVariable struct {
@@ -88,6 +121,7 @@ type nodeFilteredVariable struct {
 type nodeVariable struct {
 	locationToken *Token
 	expr          IEvaluator
+	escapeContext escapeContext // HTML context of the variable (for AutoescapeContextual)
 }
 
 type executionCtxEval struct{}
@@ -146,6 +180,15 @@ func (b *boolResolver) Execute(ctx *ExecutionContext, writer TemplateWriter) *Er
 	return nil
 }
 
+func (d *dictResolver) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	value, err := d.Evaluate(ctx)
+	if err != nil {
+		return err
+	}
+	writer.WriteAny(value)
+	return nil
+}
+
 func (v *nodeFilteredVariable) GetPositionToken() *Token {
 	return v.locationToken
 }
@@ -170,6 +213,10 @@ func (b *boolResolver) GetPositionToken() *Token {
 	return b.locationToken
 }
 
+func (d *dictResolver) GetPositionToken() *Token {
+	return d.locationToken
+}
+
 func (s *stringResolver) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 	return AsValue(s.val), nil
 }
@@ -186,6 +233,18 @@ func (b *boolResolver) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 	return AsValue(b.val), nil
 }
 
+func (d *dictResolver) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
+	m := make(map[string]*Value, len(d.keys))
+	for idx, key := range d.keys {
+		value, err := d.values[idx].Evaluate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return AsValue(m), nil
+}
+
 func (s *stringResolver) FilterApplied(name string) bool {
 	return false
 }
@@ -202,6 +261,10 @@ func (b *boolResolver) FilterApplied(name string) bool {
 	return false
 }
 
+func (d *dictResolver) FilterApplied(name string) bool {
+	return false
+}
+
 func (nv *nodeVariable) FilterApplied(name string) bool {
 	return nv.expr.FilterApplied(name)
 }
@@ -212,13 +275,7 @@ func (nv *nodeVariable) Execute(ctx *ExecutionContext, writer TemplateWriter) *E
 		return err
 	}
 
-	if !nv.expr.FilterApplied("safe") && !value.safe && value.IsString() && ctx.Autoescape {
-		// apply escape filter
-		escapeReplacer.WriteString(writer, value.String())
-		return nil
-	}
-
-	writer.WriteAny(value)
+	ctx.writeValue(writer, value, nv.expr.FilterApplied("safe"), nv.escapeContext)
 	return nil
 }
 
@@ -226,6 +283,18 @@ func (executionCtxEval) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 	return AsValue(ctx), nil
 }
 
+func (kwargs kwargsEval) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
+	result := make(Kwargs, len(kwargs))
+	for _, kwarg := range kwargs {
+		value, err := kwarg.expr.Evaluate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result[kwarg.name] = value
+	}
+	return AsValue(result), nil
+}
+
 func (vr *variableResolver) FilterApplied(name string) bool {
 	return false
 }
@@ -242,6 +311,7 @@ func (vr *variableResolver) String() string {
 func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 	var current any
 	var isSafe bool
+	defined := true // false if the last looked up part doesn't exist
 
 	// we are resolving an in-template array definition
 	if len(vr.parts) > 0 && vr.parts[0].typ == varTypeArray {
@@ -261,7 +331,7 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 		}
 
 		return &Value{
-			val:  reflect.ValueOf(items),
+			val:  items,
 			safe: true,
 		}, nil
 	}
@@ -274,21 +344,18 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 			val, inPrivate := ctx.Private[vr.parts[0].s]
 			if !inPrivate {
 				// Nothing found? Then have a final lookup in the public context
-				val = ctx.Public[vr.parts[0].s]
+				val, defined = ctx.Public[vr.parts[0].s]
+				if !defined {
+					val, defined = builtinFunctions[vr.parts[0].s]
+				}
 			}
 			current = val // Keep as raw any value
 		} else {
 			// Next parts, resolve it from current
 
-			// Handle *Value unwrapping
-			if v, ok := current.(*Value); ok {
-				current = v.val
-				isSafe = v.safe
-			}
-
 			// Check if nil
 			if current == nil {
-				return AsValue(nil), nil
+				return undefinedValue(), nil
 			}
 
 			// For method calls and complex operations, we need reflect.Value
@@ -300,9 +367,12 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 			if part.typ == varTypeIdent {
 				funcValue := rv.MethodByName(part.s)
 				if funcValue.IsValid() {
+					if err := ctx.template.set.AccessPolicy.checkMethod(rv.Type(), part.s); err != nil {
+						return nil, fmt.Errorf("%w (variable %s)", err, vr.String())
+					}
 					rv = funcValue
 					isFunc = true
-					current = nil // Signal we're using rv
+					current = funcValue.Interface()
 				}
 			}
 
@@ -312,7 +382,7 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 					rv = rv.Elem()
 					if !rv.IsValid() {
 						// Value is not valid (anymore)
-						return AsValue(nil), nil
+						return undefinedValue(), nil
 					}
 					// Update current to the dereferenced value
 					current = rv.Interface()
@@ -330,7 +400,7 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 							current = rv.Interface()
 						} else {
 							// In Django, exceeding the length of a list is just empty.
-							return AsValue(nil), nil
+							return undefinedValue(), nil
 						}
 					default:
 						return nil, fmt.Errorf("can't access an index on type %s (variable %s)",
@@ -341,12 +411,15 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 					switch rv.Kind() {
 					case reflect.Struct:
 						// Use cached field lookup for better performance
-						if indices, ok := globalStructFieldCache.getFieldIndex(rv.Type(), part.s); ok {
+						if indices, ok := globalStructFieldCache.getField(rv.Type(), part.s, ctx.template.Options.JSONTagFallback); ok {
+							if err := ctx.template.set.AccessPolicy.checkField(rv.Type(), rv.Type().FieldByIndex(indices)); err != nil {
+								return nil, fmt.Errorf("%w (variable %s)", err, vr.String())
+							}
 							rv = rv.FieldByIndex(indices)
 							current = rv.Interface()
 						} else {
 							// Field not found
-							return AsValue(nil), nil
+							return undefinedValue(), nil
 						}
 					case reflect.Map:
 						rv = rv.MapIndex(reflect.ValueOf(part.s))
@@ -354,6 +427,7 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 							current = rv.Interface()
 						} else {
 							current = nil
+							defined = false
 						}
 					default:
 						return nil, fmt.Errorf("can't access a field by name on type %s (variable %s)",
@@ -374,7 +448,7 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 							current = rv.Interface()
 						} else {
 							// In Django, exceeding the length of a list is just empty.
-							return AsValue(nil), nil
+							return undefinedValue(), nil
 						}
 					// Calling a field or key
 					case reflect.Struct:
@@ -384,12 +458,15 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 						}
 						fieldName := sv.String()
 						// Use cached field lookup for better performance
-						if indices, ok := globalStructFieldCache.getFieldIndex(rv.Type(), fieldName); ok {
+						if indices, ok := globalStructFieldCache.getField(rv.Type(), fieldName, ctx.template.Options.JSONTagFallback); ok {
+							if err := ctx.template.set.AccessPolicy.checkField(rv.Type(), rv.Type().FieldByIndex(indices)); err != nil {
+								return nil, fmt.Errorf("%w (variable %s)", err, vr.String())
+							}
 							rv = rv.FieldByIndex(indices)
 							current = rv.Interface()
 						} else {
 							// Field not found
-							return AsValue(nil), nil
+							return undefinedValue(), nil
 						}
 					case reflect.Map:
 						sv, err := part.subscript.Evaluate(ctx)
@@ -397,7 +474,7 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 							return nil, err
 						}
 						if sv.IsNil() {
-							return AsValue(nil), nil
+							return undefinedValue(), nil
 						}
 						svRV := reflect.ValueOf(sv.val)
 						if svRV.IsValid() && svRV.Type().AssignableTo(rv.Type().Key()) {
@@ -406,9 +483,10 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 								current = rv.Interface()
 							} else {
 								current = nil
+								defined = false
 							}
 						} else {
-							return AsValue(nil), nil
+							return undefinedValue(), nil
 						}
 					default:
 						return nil, fmt.Errorf("can't access an index on type %s (variable %s)",
@@ -417,22 +495,24 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 				default:
 					panic("unimplemented")
 				}
-			} else {
-				// We have a function from method lookup, keep using rv
-				current = nil
 			}
+		}
 
-			// If we're using rv (for function calls), ensure current is nil
-			// Otherwise current has the value
-			if current == nil && rv.IsValid() {
-				// We need rv for next iteration or function call
-				// Store back as reflect value operation
-				current = rv
+		// Unwrap values which are already a *Value (e. g. provided by tags or macros)
+		if v, ok := current.(*Value); ok {
+			if v == nil {
+				current = nil
+			} else {
+				current = v.val
+				isSafe = v.safe
 			}
 		}
 
 		// Check for nil or invalid
 		if current == nil {
+			if !defined {
+				return undefinedValue(), nil
+			}
 			return AsValue(nil), nil
 		}
 
@@ -449,11 +529,41 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 			t := rv.Type()
 			currArgs := part.callingArgs
 
+			// A call-block can only be passed to a macro
+			if n := len(currArgs); n > 0 {
+				if _, isCaller := currArgs[n-1].(*callerArgument); isCaller {
+					if _, isMacro := current.(macroFunc); !isMacro {
+						return nil, fmt.Errorf("'%s' is not a macro (only macros can be used by the call-tag)", vr.String())
+					}
+				}
+			}
+
 			// If an implicit ExecCtx is needed
 			if t.NumIn() > 0 && t.In(0) == typeOfExecCtxPtr {
 				currArgs = append([]functionCallArgument{executionCtxEval{}}, currArgs...)
 			}
 
+			// Keyword arguments are passed to the function's Kwargs parameter (if any)
+			kwargsIdx := -1
+			for i := 0; i < t.NumIn(); i++ {
+				if t.In(i) == typeOfKwargs && !(t.IsVariadic() && i == t.NumIn()-1) {
+					kwargsIdx = i
+					break
+				}
+			}
+			if kwargsIdx < 0 && len(part.callingKwargs) > 0 {
+				return nil, fmt.Errorf("'%s' doesn't accept keyword arguments", vr.String())
+			}
+			if kwargsIdx > len(currArgs) && len(part.callingKwargs) > 0 {
+				return nil, fmt.Errorf("'%s' is missing positional arguments before kwargs", vr.String())
+			}
+			if kwargsIdx >= 0 && kwargsIdx <= len(currArgs) {
+				withKwargs := make([]functionCallArgument, 0, len(currArgs)+1)
+				withKwargs = append(withKwargs, currArgs[:kwargsIdx]...)
+				withKwargs = append(withKwargs, kwargsEval(part.callingKwargs))
+				currArgs = append(withKwargs, currArgs[kwargsIdx:]...)
+			}
+
 			// Input arguments
 			if len(currArgs) != t.NumIn() && !(len(currArgs) >= t.NumIn()-1 && t.IsVariadic()) {
 				return nil,
@@ -523,6 +633,13 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 				}
 			}
 
+			// Don't call any functions anymore if the execution has been cancelled
+			select {
+			case <-ctx.done:
+				return nil, ctx.goCtx.Err()
+			default:
+			}
+
 			// Call it and get first return parameter back
 			values := rv.Call(parameters)
 			retVal := values[0]
@@ -557,13 +674,38 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 }
 
 func (vr *variableResolver) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
+	if err := ctx.countEvaluation(vr.locationToken); err != nil {
+		return nil, err
+	}
 	value, err := vr.resolve(ctx)
 	if err != nil {
-		return AsValue(nil), ctx.Error(err.Error(), vr.locationToken)
+		return AsValue(nil), ctx.OrigError(err, vr.locationToken)
+	}
+	if value.undefined && !vr.allowUndefined {
+		switch ctx.template.Options.Undefined {
+		case UndefinedLog:
+			logger.Printf("[template set: %s] %s:%d:%d: %s: '%s'", ctx.template.set.name, vr.locationToken.Filename,
+				vr.locationToken.Line, vr.locationToken.Col, ErrUndefinedVariable, vr.String())
+		case UndefinedError:
+			return nil, ctx.OrigError(fmt.Errorf("%w: '%s'", ErrUndefinedVariable, vr.String()), vr.locationToken)
+		}
 	}
 	return value, nil
 }
 
+// allowUndefined exempts a plain variable from the undefined policy; it's
+// used for variables passed to the `default` filter and the `defined` test.
+func allowUndefined(expr IEvaluator) {
+	switch e := expr.(type) {
+	case *variableResolver:
+		e.allowUndefined = true
+	case *nodeFilteredVariable:
+		if len(e.filterChain) == 0 {
+			allowUndefined(e.resolver)
+		}
+	}
+}
+
 func (v *nodeFilteredVariable) FilterApplied(name string) bool {
 	for _, filter := range v.filterChain {
 		if filter.name == name {
@@ -632,7 +774,66 @@ func (p *Parser) parseArray() (IEvaluator, *Error) {
 	return resolver, nil
 }
 
-// IDENT | IDENT.(IDENT|NUMBER)... | IDENT[expr]... | "[" [ expr {, expr}] "]"
+// "{" [ (STRING|IDENT) ":" expr {, (STRING|IDENT) ":" expr}] "}"
+func (p *Parser) parseDict() (IEvaluator, *Error) {
+	resolver := &dictResolver{
+		locationToken: p.Current(),
+	}
+	p.Consume() // We consume '{'
+
+	// We allow an empty dictionary, so check for a closing brace.
+	if p.Match(TokenSymbol, "}") != nil {
+		return resolver, nil
+	}
+
+	// parsing a dictionary declaration with at least one entry
+	for {
+		if p.Remaining() == 0 {
+			return nil, p.Error("Unexpected EOF, unclosed dictionary.", p.lastToken)
+		}
+
+		// Keys are either strings or identifiers (which are used as names, not resolved as variables)
+		keyToken := p.Current()
+		if keyToken.Typ != TokenString && keyToken.Typ != TokenIdentifier {
+			return nil, p.Error("Dictionary keys must be either strings or identifiers.", keyToken)
+		}
+		for _, key := range resolver.keys {
+			if key == keyToken.Val {
+				return nil, p.Error(fmt.Sprintf("Duplicate dictionary key '%s'.", keyToken.Val), keyToken)
+			}
+		}
+		p.Consume() // consume: key
+
+		if p.Match(TokenSymbol, ":") == nil {
+			return nil, p.Error("Expected ':' after dictionary key.", p.Current())
+		}
+		if p.Remaining() == 0 {
+			return nil, p.Error("Unexpected EOF, expected dictionary value.", p.lastToken)
+		}
+
+		valueExpr, err := p.ParseExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		resolver.keys = append(resolver.keys, keyToken.Val)
+		resolver.values = append(resolver.values, valueExpr)
+
+		if p.Match(TokenSymbol, "}") != nil {
+			// If there's a closing brace after an entry, we will stop parsing the entries
+			break
+		}
+
+		// If there's NO closing brace, there MUST be an comma
+		if p.Match(TokenSymbol, ",") == nil {
+			return nil, p.Error("Missing comma or closing brace after dictionary entry.", p.Current())
+		}
+	}
+
+	return resolver, nil
+}
+
+// IDENT | IDENT.(IDENT|NUMBER)... | IDENT[expr]... | "[" [ expr {, expr}] "]" | "{" [ key ":" expr {, key ":" expr}] "}"
 func (p *Parser) parseVariableOrLiteral() (IEvaluator, *Error) {
 	t := p.Current()
 
@@ -705,6 +906,10 @@ func (p *Parser) parseVariableOrLiteral() (IEvaluator, *Error) {
 			// Parsing an array literal [expr {, expr}]
 			return p.parseArray()
 		}
+		if t.Val == "{" {
+			// Parsing a dictionary literal {key: expr {, key: expr}}
+			return p.parseDict()
+		}
 	}
 
 	resolver := &variableResolver{
@@ -722,6 +927,16 @@ func (p *Parser) parseVariableOrLiteral() (IEvaluator, *Error) {
 	})
 	p.Consume() // we consumed the first identifier of the variable name
 
+	// A macro referring to varargs/kwargs accepts surplus arguments
+	if p.macro != nil {
+		switch t.Val {
+		case "varargs":
+			p.macro.catchVarargs = true
+		case "kwargs":
+			p.macro.catchKwargs = true
+		}
+	}
+
 variableLoop:
 	for p.Remaining() > 0 {
 		if p.Match(TokenSymbol, ".") != nil {
@@ -792,12 +1007,31 @@ variableLoop:
 				}
 
 				if p.Peek(TokenSymbol, ")") == nil {
-					// No closing bracket, so we're parsing an expression
-					exprArg, err := p.ParseExpression()
-					if err != nil {
-						return nil, err
+					if p.PeekType(TokenIdentifier) != nil && p.PeekN(1, TokenSymbol, "=") != nil {
+						// Keyword argument: name '=' expression
+						nameToken := p.MatchType(TokenIdentifier)
+						p.Consume() // '='
+						for _, kwarg := range part.callingKwargs {
+							if kwarg.name == nameToken.Val {
+								return nil, p.Error(fmt.Sprintf("Duplicate keyword argument '%s'.", nameToken.Val), nameToken)
+							}
+						}
+						exprArg, err := p.ParseExpression()
+						if err != nil {
+							return nil, err
+						}
+						part.callingKwargs = append(part.callingKwargs, &keywordArgument{name: nameToken.Val, expr: exprArg})
+					} else {
+						// No closing bracket, so we're parsing an expression
+						if len(part.callingKwargs) > 0 {
+							return nil, p.Error("Positional argument follows keyword argument.", nil)
+						}
+						exprArg, err := p.ParseExpression()
+						if err != nil {
+							return nil, err
+						}
+						part.callingArgs = append(part.callingArgs, exprArg)
 					}
-					part.callingArgs = append(part.callingArgs, exprArg)
 
 					if p.Match(TokenSymbol, ")") != nil {
 						// If there's a closing bracket after an expression, we will stop parsing the arguments
@@ -847,9 +1081,8 @@ filterLoop:
 			return nil, err
 		}
 
-		// Check sandbox filter restriction
-		if _, isBanned := p.template.set.bannedFilters[filter.name]; isBanned {
-			return nil, p.Error(fmt.Sprintf("Usage of filter '%s' is not allowed (sandbox restriction active).", filter.name), nil)
+		if len(v.filterChain) == 0 && (filter.name == "default" || filter.name == "default_if_none") {
+			allowUndefined(v.resolver)
 		}
 
 		v.filterChain = append(v.filterChain, filter)
@@ -863,6 +1096,7 @@ filterLoop:
 func (p *Parser) parseVariableElement() (INode, *Error) {
 	node := &nodeVariable{
 		locationToken: p.Current(),
+		escapeContext: p.escapeContext,
 	}
 
 	p.Consume() // consume '{{'
@@ -876,6 +1110,7 @@ func (p *Parser) parseVariableElement() (INode, *Error) {
 	if p.Match(TokenSymbol, "}}") == nil {
 		return nil, p.Error("'}}' expected", nil)
 	}
+	p.escapeContext = p.escapeContext.afterValue()
 
 	return node, nil
 }